@@ -24,24 +24,52 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"log"
 
 	"github.com/ubports/ciborium/qml.v1"
+	"github.com/ubports/ciborium/registry"
 	"github.com/ubports/ciborium/udisks2"
 	"launchpad.net/go-dbus/v1"
 	"launchpad.net/go-xdg/v0"
 )
 
 type driveControl struct {
-	udisks         *udisks2.UDisks2
-	ExternalDrives []udisks2.Drive
-	Len            int
-	Formatting     bool
-	FormatError    bool
-	Unmounting     bool
-	UnmountError   bool
+	udisks              *udisks2.UDisks2
+	registry            *registry.Registry
+	ExternalDrives      []udisks2.Drive
+	Len                 int
+	Formatting          bool
+	FormatError         bool
+	FormatProgress      float64
+	FormatProgressValid bool
+	FormatCancelled     bool
+	Unmounting          bool
+	UnmountError        bool
+	UnmountBusy         string
+	ReadyToRemove       bool
+	Detached            bool
+	Unlocking           bool
+	UnlockError         bool
+	Checking            bool
+	CheckError          bool
+	CheckRepaired       bool
+	checkPending        int
+	Renaming            bool
+	RenameError         bool
+	Writing             bool
+	WriteError          bool
+	WriteProgress       float64
+	WriteVerifying      bool
+	BackingUp           bool
+	BackupError         bool
+	BackupCancelled     bool
+	BackupProgress      float64
+	BackupImage         string
+	backupDrive         *udisks2.Drive
+	formatDrive         *udisks2.Drive
 }
 
 type DriveList struct {
@@ -50,7 +78,8 @@ type DriveList struct {
 }
 
 var mainQmlPath = filepath.Join("ciborium", "qml", "main.qml")
-var supportedFS []string = []string{"vfat"}
+var registryPath = filepath.Join("ciborium", "devices.json")
+var supportedFS []string = []string{udisks2.FilesystemVfat, udisks2.FilesystemExfat, udisks2.FilesystemExt4, udisks2.FilesystemNtfs}
 
 func init() {
 	os.Setenv("APP_ID", "ciborium")
@@ -102,6 +131,7 @@ func run() error {
 
 	window.Show()
 	window.Wait()
+	driveCtrl.udisks.Close()
 	return nil
 }
 
@@ -112,7 +142,16 @@ func newDriveControl() (*driveControl, error) {
 	}
 	udisks := udisks2.NewStorageWatcher(systemBus, supportedFS...)
 
-	return &driveControl{udisks: udisks}, nil
+	p, err := xdg.Data.Ensure(registryPath)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := registry.Open(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &driveControl{udisks: udisks, registry: reg}, nil
 }
 
 func (ctrl *driveControl) Watch() {
@@ -131,18 +170,85 @@ func (ctrl *driveControl) Watch() {
 			ctrl.Drives()
 		}
 	}()
+	// keep the drives up to date when their properties change outside of ciborium
+	changes := ctrl.udisks.SubscribeChangeEvents()
+	go func() {
+		for e := range changes {
+			log.Println("Properties", e.Properties, "changed for", e.Path)
+			ctrl.Drives()
+		}
+	}()
+	// show the unlock action as soon as an encrypted drive is added
+	unlockRequired := ctrl.udisks.SubscribeUnlockEvents()
+	go func() {
+		for e := range unlockRequired {
+			log.Println("Encrypted block", e.Path, "must be unlocked")
+			ctrl.Drives()
+		}
+	}()
+	// repair the filesystems the check finds errors in
+	go func() {
+		checkCompleted, checkErrors := ctrl.udisks.SubscribeCheckEvents()
+		for {
+			select {
+			case e, ok := <-checkCompleted:
+				if !ok {
+					return
+				}
+				log.Println("Check done for", e.Path, "consistent:", e.Consistent, "repaired:", e.Repaired)
+				if !e.Consistent && !e.Repaired {
+					ctrl.udisks.Repair(e.Path)
+					continue
+				}
+				if e.Repaired {
+					ctrl.CheckRepaired = true
+					qml.Changed(ctrl, &ctrl.CheckRepaired)
+				}
+				if !e.Consistent {
+					ctrl.CheckError = true
+					qml.Changed(ctrl, &ctrl.CheckError)
+				}
+			case e, ok := <-checkErrors:
+				if !ok {
+					return
+				}
+				log.Println("Check error", e)
+				ctrl.CheckError = true
+				qml.Changed(ctrl, &ctrl.CheckError)
+			}
+			ctrl.checkPending--
+			if ctrl.checkPending == 0 {
+				ctrl.Checking = false
+				qml.Changed(ctrl, &ctrl.Checking)
+			}
+		}
+	}()
 	// deal with the format jobs so that we do show the dialog correctly
 	go func() {
 		formatDone, formatErrors := ctrl.udisks.SubscribeFormatEvents()
 		for {
 			select {
-			case d := <-formatDone:
+			case d, ok := <-formatDone:
+				if !ok {
+					return
+				}
 				log.Println("Formatting job done", d)
 				ctrl.Formatting = false
 				qml.Changed(ctrl, &ctrl.Formatting)
 				ctrl.FormatError = false
 				qml.Changed(ctrl, &ctrl.FormatError)
-			case e := <-formatErrors:
+			case e, ok := <-formatErrors:
+				if !ok {
+					return
+				}
+				if e == udisks2.ErrCancelled {
+					log.Println("Formatting job cancelled")
+					ctrl.Formatting = false
+					qml.Changed(ctrl, &ctrl.Formatting)
+					ctrl.FormatCancelled = true
+					qml.Changed(ctrl, &ctrl.FormatCancelled)
+					continue
+				}
 				log.Println("Formatting job error", e)
 				ctrl.FormatError = true
 				qml.Changed(ctrl, &ctrl.FormatError)
@@ -150,25 +256,152 @@ func (ctrl *driveControl) Watch() {
 		}
 	}()
 
+	// show the progress of the format jobs in the dialog
+	progress := ctrl.udisks.SubscribeJobProgress()
+	go func() {
+		for p := range progress {
+			if !p.IsFormatJob() {
+				continue
+			}
+			log.Println("Formatting job progress", p.Percent, "valid:", p.Valid)
+			ctrl.FormatProgress = p.Percent / 100
+			qml.Changed(ctrl, &ctrl.FormatProgress)
+			ctrl.FormatProgressValid = p.Valid
+			qml.Changed(ctrl, &ctrl.FormatProgressValid)
+		}
+	}()
+
+	// deal with the image writes so that the dialog shows their progress
+	go func() {
+		imageCompleted, imageErrors := ctrl.udisks.SubscribeImageEvents()
+		progress := ctrl.udisks.SubscribeImageProgress(udisks2.SubscribeOptions{Buffer: 1, Policy: udisks2.DropOldest})
+		for {
+			select {
+			case d, ok := <-imageCompleted:
+				if !ok {
+					return
+				}
+				log.Println("Image written to", d)
+				ctrl.Writing = false
+				qml.Changed(ctrl, &ctrl.Writing)
+			case e, ok := <-imageErrors:
+				if !ok {
+					return
+				}
+				log.Println("Image write error", e)
+				ctrl.WriteError = true
+				qml.Changed(ctrl, &ctrl.WriteError)
+				ctrl.Writing = false
+				qml.Changed(ctrl, &ctrl.Writing)
+			case p, ok := <-progress:
+				if !ok {
+					return
+				}
+				ctrl.WriteProgress = p.Percent / 100
+				qml.Changed(ctrl, &ctrl.WriteProgress)
+				ctrl.WriteVerifying = p.Verifying
+				qml.Changed(ctrl, &ctrl.WriteVerifying)
+			}
+		}
+	}()
+
+	// deal with the backups so that the dialog shows their progress
+	go func() {
+		backupCompleted, backupErrors := ctrl.udisks.SubscribeBackupEvents()
+		progress := ctrl.udisks.SubscribeBackupProgress(udisks2.SubscribeOptions{Buffer: 1, Policy: udisks2.DropOldest})
+		for {
+			select {
+			case e, ok := <-backupCompleted:
+				if !ok {
+					return
+				}
+				log.Println("Backup of", e.Drive, "written to", e.Image, "with sha256", e.SHA256)
+				ctrl.BackupImage = e.Image
+				qml.Changed(ctrl, &ctrl.BackupImage)
+			case e, ok := <-backupErrors:
+				if !ok {
+					return
+				}
+				if e == udisks2.ErrCancelled {
+					log.Println("Backup cancelled")
+					ctrl.BackupCancelled = true
+					qml.Changed(ctrl, &ctrl.BackupCancelled)
+				} else {
+					log.Println("Backup error", e)
+					ctrl.BackupError = true
+					qml.Changed(ctrl, &ctrl.BackupError)
+				}
+			case p, ok := <-progress:
+				if !ok {
+					return
+				}
+				ctrl.BackupProgress = p.Percent / 100
+				qml.Changed(ctrl, &ctrl.BackupProgress)
+				continue
+			}
+			ctrl.BackingUp = false
+			qml.Changed(ctrl, &ctrl.BackingUp)
+		}
+	}()
+
 	// deal with mount and unmount events so that the ui is updated accordingly
 	go func() {
 		mountCompleted, mountErrors := ctrl.udisks.SubscribeMountEvents()
 		unmountCompleted, unmountErrors := ctrl.udisks.SubscribeUnmountEvents()
+		readyToRemove, powerOffErrors := ctrl.udisks.SubscribeReadyToRemoveEvents()
+		detached := ctrl.udisks.SubscribeDetachedEvents()
 		for {
 			select {
-			case d := <-mountCompleted:
+			case d, ok := <-mountCompleted:
+				if !ok {
+					return
+				}
 				log.Println("Mount job done", d)
 				ctrl.Drives()
-			case e := <-mountErrors:
+			case e, ok := <-mountErrors:
+				if !ok {
+					return
+				}
 				log.Println("Mount job error", e)
-			case d := <-unmountCompleted:
+			case d, ok := <-unmountCompleted:
+				if !ok {
+					return
+				}
 				log.Println("Unmount job done", d)
 				ctrl.Unmounting = false
 				qml.Changed(ctrl, &ctrl.Unmounting)
-			case e := <-unmountErrors:
+			case e, ok := <-unmountErrors:
+				if !ok {
+					return
+				}
 				log.Println("Unmount job error", e)
+				ctrl.UnmountBusy = busyNames(e)
+				qml.Changed(ctrl, &ctrl.UnmountBusy)
 				ctrl.UnmountError = true
 				qml.Changed(ctrl, &ctrl.UnmountError)
+			case p, ok := <-readyToRemove:
+				if !ok {
+					return
+				}
+				log.Println("Drive ready to remove", p)
+				ctrl.Unmounting = false
+				qml.Changed(ctrl, &ctrl.Unmounting)
+				ctrl.ReadyToRemove = true
+				qml.Changed(ctrl, &ctrl.ReadyToRemove)
+			case e, ok := <-powerOffErrors:
+				if !ok {
+					return
+				}
+				log.Println("Power off error", e)
+			case p, ok := <-detached:
+				if !ok {
+					return
+				}
+				log.Println("Drive detached while still in use", p)
+				ctrl.Unmounting = false
+				qml.Changed(ctrl, &ctrl.Unmounting)
+				ctrl.Detached = true
+				qml.Changed(ctrl, &ctrl.Detached)
 			}
 		}
 	}()
@@ -179,6 +412,10 @@ func (ctrl *driveControl) Watch() {
 func (ctrl *driveControl) Drives() {
 	log.Println("Get present drives.")
 	go func() {
+		// the daemon records the devices as they are added
+		if err := ctrl.registry.Reload(); err != nil {
+			log.Println("Cannot reload the device registry:", err)
+		}
 		ctrl.ExternalDrives = ctrl.udisks.ExternalDrives()
 		ctrl.Len = len(ctrl.ExternalDrives)
 		qml.Changed(ctrl, &ctrl.ExternalDrives)
@@ -190,24 +427,351 @@ func (ctrl *driveControl) DriveModel(index int) string {
 	return ctrl.ExternalDrives[index].Model()
 }
 
+// DriveDetails returns a one line summary of the drive and its filesystems.
+func (ctrl *driveControl) DriveDetails(index int) string {
+	drive := ctrl.ExternalDrives[index]
+	details := []string{}
+	if vendor := strings.TrimSpace(drive.Vendor() + " " + drive.Model()); vendor != "" {
+		details = append(details, vendor)
+	}
+	if size := drive.Size(); size > 0 {
+		details = append(details, humanSize(size))
+	}
+	if bus := drive.ConnectionBus(); bus != "" {
+		details = append(details, bus)
+	}
+	for _, block := range drive.BlockDevices() {
+		if block.Filesystem == nil {
+			continue
+		}
+		fs := block.Type()
+		if block.Version() != "" {
+			fs += " (" + block.Version() + ")"
+		}
+		details = append(details, fs)
+	}
+	if device, ok := ctrl.registry.Lookup(deviceKey(drive)); ok && !device.FirstSeen.IsZero() {
+		details = append(details, "first seen "+device.FirstSeen.Format("2 Jan 2006"))
+	}
+	return strings.Join(details, " · ")
+}
+
+// humanSize formats a size in bytes using decimal units, like storage vendors do.
+func humanSize(size uint64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	value := float64(size)
+	i := 0
+	for value >= 1000 && i < len(units)-1 {
+		value /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", size, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
+
+// DriveNickname returns the name the user gave to the drive, if any.
+func (ctrl *driveControl) DriveNickname(index int) string {
+	device, _ := ctrl.registry.Lookup(deviceKey(ctrl.ExternalDrives[index]))
+	return device.Nickname
+}
+
+func (ctrl *driveControl) DriveSetNickname(index int, nickname string) {
+	uuid, serial := deviceKey(ctrl.ExternalDrives[index])
+	device, known := ctrl.registry.Lookup(uuid, serial)
+	if !known {
+		var err error
+		if device, _, err = ctrl.registry.Seen(uuid, serial, time.Now()); err != nil {
+			log.Println("Cannot record the device in the registry:", err)
+			return
+		}
+	}
+	device.Nickname = nickname
+	if err := ctrl.registry.Update(device); err != nil {
+		log.Println("Cannot set the nickname of the device:", err)
+	}
+	ctrl.Drives()
+}
+
+// deviceKey returns the filesystem UUID and the serial that identify the drive in the
+// device registry.
+func deviceKey(drive udisks2.Drive) (string, string) {
+	for _, block := range drive.BlockDevices() {
+		if block.Filesystem != nil && block.UUID() != "" {
+			return block.UUID(), drive.Serial()
+		}
+	}
+	return "", drive.Serial()
+}
+
+// DriveLabel returns the label of the drive, empty if its filesystems have none.
+func (ctrl *driveControl) DriveLabel(index int) string {
+	return ctrl.ExternalDrives[index].IdLabel()
+}
+
+func (ctrl *driveControl) DriveSetLabel(index int, label string) {
+	drive := ctrl.ExternalDrives[index]
+	var path dbus.ObjectPath
+	for _, block := range drive.BlockDevices() {
+		if block.Filesystem != nil {
+			path = block.Path
+			break
+		}
+	}
+
+	ctrl.Renaming = true
+	ctrl.RenameError = false
+	qml.Changed(ctrl, &ctrl.Renaming)
+	qml.Changed(ctrl, &ctrl.RenameError)
+	go func() {
+		if path == "" {
+			log.Println("No filesystem to label in drive", drive.Path)
+			ctrl.RenameError = true
+		} else if err := ctrl.udisks.SetLabel(path, label); err != nil {
+			log.Println("Set label error", err)
+			ctrl.RenameError = true
+		}
+		qml.Changed(ctrl, &ctrl.RenameError)
+		ctrl.Renaming = false
+		qml.Changed(ctrl, &ctrl.Renaming)
+		ctrl.Drives()
+	}()
+}
+
 func (ctrl *driveControl) DriveFormat(index int) {
+	ctrl.driveFormat(index, udisks2.DefaultFormatOptions)
+}
+
+// DriveFormatEncrypted formats the drive with a LUKS container protected by the
+// passphrase.
+func (ctrl *driveControl) DriveFormatEncrypted(index int, passphrase string) {
+	opts := udisks2.DefaultFormatOptions
+	opts.Passphrase = passphrase
+	ctrl.driveFormat(index, opts)
+}
+
+func (ctrl *driveControl) driveFormat(index int, opts udisks2.FormatOptions) {
 	ctrl.Formatting = true
 	ctrl.FormatError = false
 	ctrl.UnmountError = false
+	ctrl.FormatProgress = 0
+	ctrl.FormatProgressValid = false
+	ctrl.FormatCancelled = false
 	qml.Changed(ctrl, &ctrl.Formatting)
+	qml.Changed(ctrl, &ctrl.FormatProgress)
+	qml.Changed(ctrl, &ctrl.FormatProgressValid)
+	qml.Changed(ctrl, &ctrl.FormatCancelled)
 
 	drive := ctrl.ExternalDrives[index]
+	ctrl.formatDrive = &drive
 
 	log.Println("Format drive on index", index, "model", drive.Model(), "path", drive.Path)
-	ctrl.udisks.Format(&drive)
+	ctrl.udisks.Format(&drive, opts)
+}
+
+func (ctrl *driveControl) DriveFormatCancel() {
+	if ctrl.formatDrive == nil {
+		log.Println("No format in progress to cancel")
+		return
+	}
+	log.Println("Cancelling format of drive", ctrl.formatDrive.Path)
+	if err := ctrl.udisks.CancelFormat(ctrl.formatDrive); err != nil {
+		log.Println("Cannot cancel format:", err)
+	}
 }
 
 func (ctrl *driveControl) DriveUnmount(index int) {
 	log.Println("Unmounting device.")
+	ctrl.driveSafeRemove(index, udisks2.DefaultUnmountMode)
+}
+
+// DriveForceUnmount lazily unmounts the filesystems that are still busy, the user has to
+// confirm it first.
+func (ctrl *driveControl) DriveForceUnmount(index int) {
+	log.Println("Forcing the unmount of the device.")
+	ctrl.driveSafeRemove(index, udisks2.ForceUnmountMode)
+}
+
+func (ctrl *driveControl) driveSafeRemove(index int, mode udisks2.UnmountMode) {
 	drive := ctrl.ExternalDrives[index]
 	ctrl.Unmounting = true
+	ctrl.UnmountError = false
+	ctrl.UnmountBusy = ""
+	ctrl.ReadyToRemove = false
+	ctrl.Detached = false
 	qml.Changed(ctrl, &ctrl.Unmounting)
-	ctrl.udisks.Unmount(&drive)
+	qml.Changed(ctrl, &ctrl.UnmountError)
+	qml.Changed(ctrl, &ctrl.UnmountBusy)
+	qml.Changed(ctrl, &ctrl.ReadyToRemove)
+	qml.Changed(ctrl, &ctrl.Detached)
+	ctrl.udisks.SafeRemove(&drive, mode)
+}
+
+// busyNames returns the names of the processes that keep the filesystem busy.
+func busyNames(err error) string {
+	busy, ok := err.(*udisks2.BusyError)
+	if !ok {
+		return ""
+	}
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, p := range busy.Processes {
+		if name := p.Name(); name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// DriveWriteImage writes the raw, gz or xz image file to the drive, replacing all of
+// its content.
+func (ctrl *driveControl) DriveWriteImage(index int, image string) {
+	ctrl.Writing = true
+	ctrl.WriteError = false
+	ctrl.WriteProgress = 0
+	ctrl.WriteVerifying = false
+	qml.Changed(ctrl, &ctrl.Writing)
+	qml.Changed(ctrl, &ctrl.WriteError)
+	qml.Changed(ctrl, &ctrl.WriteProgress)
+	qml.Changed(ctrl, &ctrl.WriteVerifying)
+
+	drive := ctrl.ExternalDrives[index]
+	log.Println("Writing", image, "to drive on index", index, "path", drive.Path)
+	ctrl.udisks.WriteImage(&drive, image)
+}
+
+// DriveBackupPath returns the image file suggested for the backup of the drive.
+func (ctrl *driveControl) DriveBackupPath(index int) string {
+	drive := ctrl.ExternalDrives[index]
+	name := ctrl.DriveLabel(index)
+	if name == "" {
+		name = drive.Model()
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == ' ' {
+			return '-'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "card"
+	}
+	return filepath.Join(os.Getenv("HOME"), name+"-"+time.Now().Format("20060102")+".img.gz")
+}
+
+// DriveBackup copies the whole drive to the image file, compressed when it ends in .gz
+// or .xz.
+func (ctrl *driveControl) DriveBackup(index int, image string) {
+	ctrl.BackingUp = true
+	ctrl.BackupError = false
+	ctrl.BackupCancelled = false
+	ctrl.BackupProgress = 0
+	ctrl.BackupImage = ""
+	qml.Changed(ctrl, &ctrl.BackingUp)
+	qml.Changed(ctrl, &ctrl.BackupError)
+	qml.Changed(ctrl, &ctrl.BackupCancelled)
+	qml.Changed(ctrl, &ctrl.BackupProgress)
+	qml.Changed(ctrl, &ctrl.BackupImage)
+
+	drive := ctrl.ExternalDrives[index]
+	ctrl.backupDrive = &drive
+	log.Println("Backing up drive on index", index, "path", drive.Path, "to", image)
+	ctrl.udisks.Backup(&drive, image)
+}
+
+func (ctrl *driveControl) DriveBackupCancel() {
+	if ctrl.backupDrive == nil {
+		log.Println("No backup in progress to cancel")
+		return
+	}
+	if err := ctrl.udisks.CancelBackup(ctrl.backupDrive); err != nil {
+		log.Println("Cannot cancel backup:", err)
+	}
+}
+
+func (ctrl *driveControl) DriveEjectable(index int) bool {
+	return ctrl.ExternalDrives[index].Ejectable()
+}
+
+func (ctrl *driveControl) DriveEject(index int) {
+	drive := ctrl.ExternalDrives[index]
+	log.Println("Ejecting drive on index", index, "path", drive.Path)
+	go func() {
+		if err := ctrl.udisks.Eject(&drive); err != nil {
+			log.Println("Eject error", err)
+			return
+		}
+		ctrl.Drives()
+	}()
+}
+
+// DriveCheck checks the filesystems of the drive and repairs the ones holding errors.
+func (ctrl *driveControl) DriveCheck(index int) {
+	drive := ctrl.ExternalDrives[index]
+	var paths []dbus.ObjectPath
+	for _, block := range drive.BlockDevices() {
+		if block.Filesystem != nil {
+			paths = append(paths, block.Path)
+		}
+	}
+
+	ctrl.CheckError = false
+	ctrl.CheckRepaired = false
+	qml.Changed(ctrl, &ctrl.CheckError)
+	qml.Changed(ctrl, &ctrl.CheckRepaired)
+	if len(paths) == 0 {
+		log.Println("No filesystem to check in drive", drive.Path)
+		ctrl.CheckError = true
+		qml.Changed(ctrl, &ctrl.CheckError)
+		return
+	}
+
+	ctrl.checkPending = len(paths)
+	ctrl.Checking = true
+	qml.Changed(ctrl, &ctrl.Checking)
+	for _, p := range paths {
+		log.Println("Checking filesystem", p)
+		ctrl.udisks.Check(p)
+	}
+}
+
+// DriveLocked returns if the drive holds an encrypted block device that is locked.
+func (ctrl *driveControl) DriveLocked(index int) bool {
+	return lockedBlock(ctrl.ExternalDrives[index]) != ""
+}
+
+func (ctrl *driveControl) DriveUnlock(index int, passphrase string) {
+	drive := ctrl.ExternalDrives[index]
+	ctrl.Unlocking = true
+	ctrl.UnlockError = false
+	qml.Changed(ctrl, &ctrl.Unlocking)
+	qml.Changed(ctrl, &ctrl.UnlockError)
+
+	go func() {
+		// the cleartext device is automounted once it shows up
+		cleartext, err := ctrl.udisks.Unlock(lockedBlock(drive), passphrase)
+		if err != nil {
+			log.Println("Unlock error", err)
+			ctrl.UnlockError = true
+			qml.Changed(ctrl, &ctrl.UnlockError)
+		} else {
+			log.Println("Unlocked drive", drive.Path, "as", cleartext)
+		}
+		ctrl.Unlocking = false
+		qml.Changed(ctrl, &ctrl.Unlocking)
+		ctrl.Drives()
+	}()
+}
+
+func lockedBlock(drive udisks2.Drive) dbus.ObjectPath {
+	for _, block := range drive.BlockDevices() {
+		if block.Encrypted != nil && !block.Encrypted.Unlocked() {
+			return block.Path
+		}
+	}
+	return ""
 }
 
 func (ctrl *driveControl) DriveAt(index int) *udisks2.Drive {
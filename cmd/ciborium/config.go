@@ -0,0 +1,95 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/ubports/ciborium/udisks2"
+	"launchpad.net/go-xdg/v0"
+)
+
+var configPath = filepath.Join("ciborium", "config.json")
+
+// config holds the settings read from ciborium/config.json in the XDG config dirs.
+type config struct {
+	MountPolicy    udisks2.MountPolicy    `json:"mount-policy"`
+	AutomountRules udisks2.AutomountRules `json:"automount"`
+}
+
+func defaultConfig() config {
+	// the maps are copied as decoding the file adds its entries to them
+	policy := udisks2.DefaultMountPolicy
+	policy.Filesystems = make(map[string][]string)
+	for fs, opts := range udisks2.DefaultMountPolicy.Filesystems {
+		policy.Filesystems[fs] = opts
+	}
+	policy.Devices = make(map[string][]string)
+	for device, opts := range udisks2.DefaultMountPolicy.Devices {
+		policy.Devices[device] = opts
+	}
+	return config{MountPolicy: policy, AutomountRules: udisks2.DefaultAutomountRules}
+}
+
+// lockedConfig is used when the configuration file cannot be read, nothing is
+// automounted as the file may hold rules blocking some devices.
+func lockedConfig() config {
+	c := defaultConfig()
+	c.AutomountRules = udisks2.AutomountRules{Default: udisks2.AutomountIgnore}
+	return c
+}
+
+// loadConfig reads the configuration file, the defaults are used for the missing
+// settings and when there is no configuration file. Only the system config dirs are
+// looked up so that users cannot replace the rules set by the administrator.
+func loadConfig() (config, error) {
+	home := xdg.Config.Home()
+	for _, dir := range xdg.Config.Dirs() {
+		if dir == home {
+			continue
+		}
+		p := filepath.Join(dir, configPath)
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			continue
+		}
+		return readConfig(p)
+	}
+	return defaultConfig(), nil
+}
+
+// readConfig reads the configuration file at p, lockedConfig is returned with the error
+// when the file exists but cannot be read.
+func readConfig(p string) (config, error) {
+	c := defaultConfig()
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return lockedConfig(), err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&c); err != nil {
+		return lockedConfig(), err
+	}
+	if err := c.AutomountRules.Validate(); err != nil {
+		return lockedConfig(), err
+	}
+	return c, nil
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/ubports/ciborium/udisks2"
+	. "launchpad.net/gocheck"
+)
+
+var _ = Suite(&ConfigTestSuite{})
+
+type ConfigTestSuite struct {
+	tmpDir string
+}
+
+func (s *ConfigTestSuite) SetUpTest(c *C) {
+	s.tmpDir = c.MkDir()
+}
+
+func (s *ConfigTestSuite) write(c *C, content string) string {
+	p := filepath.Join(s.tmpDir, "config.json")
+	c.Assert(ioutil.WriteFile(p, []byte(content), 0644), IsNil)
+	return p
+}
+
+func (s *ConfigTestSuite) TestMissingFile(c *C) {
+	cfg, err := readConfig(filepath.Join(s.tmpDir, "missing.json"))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.MountPolicy.Default, DeepEquals, udisks2.DefaultMountPolicy.Default)
+}
+
+func (s *ConfigTestSuite) TestMountPolicy(c *C) {
+	p := s.write(c, `{"mount-policy": {"filesystems": {"vfat": ["ro", "noexec"]}, "devices": {"1234-ABCD": ["sync"]}}}`)
+	cfg, err := readConfig(p)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.MountPolicy.Filesystems["vfat"], DeepEquals, []string{"ro", "noexec"})
+	c.Assert(cfg.MountPolicy.Devices["1234-ABCD"], DeepEquals, []string{"sync"})
+	// settings missing from the file keep their defaults
+	c.Assert(cfg.MountPolicy.Default, DeepEquals, udisks2.DefaultMountPolicy.Default)
+	c.Assert(cfg.MountPolicy.Filesystems["exfat"], DeepEquals, udisks2.DefaultMountPolicy.Filesystems["exfat"])
+	c.Assert(udisks2.DefaultMountPolicy.Filesystems["vfat"], Not(DeepEquals), []string{"ro", "noexec"})
+}
+
+func (s *ConfigTestSuite) TestAutomountRules(c *C) {
+	p := s.write(c, `{"automount": {"default": "notify", "rules": [{"serial": "SERIAL0001", "action": "mount"}]}}`)
+	cfg, err := readConfig(p)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.AutomountRules.Default, Equals, udisks2.AutomountNotify)
+	c.Assert(cfg.AutomountRules.Rules, DeepEquals, []udisks2.AutomountRule{
+		{Serial: "SERIAL0001", Action: udisks2.AutomountMount},
+	})
+}
+
+func (s *ConfigTestSuite) TestInvalidFile(c *C) {
+	p := s.write(c, `{"mount-policy": `)
+	cfg, err := readConfig(p)
+	c.Assert(err, NotNil)
+	c.Assert(cfg.AutomountRules, DeepEquals, udisks2.AutomountRules{Default: udisks2.AutomountIgnore})
+}
+
+func (s *ConfigTestSuite) TestUnknownAutomountAction(c *C) {
+	p := s.write(c, `{"automount": {"default": "mount", "rules": [{"connection-bus": "usb", "action": "deny"}]}}`)
+	cfg, err := readConfig(p)
+	c.Assert(err, ErrorMatches, `unknown action "deny" in automount rule 1`)
+	c.Assert(cfg.AutomountRules, DeepEquals, udisks2.AutomountRules{Default: udisks2.AutomountIgnore})
+}
+
+func (s *ConfigTestSuite) TestUnknownAutomountDefault(c *C) {
+	p := s.write(c, `{"automount": {"default": "block"}}`)
+	cfg, err := readConfig(p)
+	c.Assert(err, NotNil)
+	c.Assert(cfg.AutomountRules.Default, Equals, udisks2.AutomountIgnore)
+}
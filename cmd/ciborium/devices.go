@@ -0,0 +1,114 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ubports/ciborium/registry"
+	"github.com/ubports/ciborium/udisks2"
+	"launchpad.net/go-dbus/v1"
+)
+
+var registryPath = filepath.Join("ciborium", "devices.json")
+
+// deviceTracker records the added devices in the registry and applies the preferences
+// stored for them.
+type deviceTracker struct {
+	udisks   *udisks2.UDisks2
+	registry *registry.Registry
+	policy   udisks2.MountPolicy
+	lock     sync.Mutex
+	// names holds the names of the known devices being mounted keyed by drive
+	names map[dbus.ObjectPath]string
+}
+
+func newDeviceTracker(u *udisks2.UDisks2, r *registry.Registry, policy udisks2.MountPolicy) *deviceTracker {
+	return &deviceTracker{
+		udisks:   u,
+		registry: r,
+		policy:   policy,
+		names:    make(map[dbus.ObjectPath]string),
+	}
+}
+
+// seen records the block device of the event and returns false if the user does not
+// want it to be mounted.
+func (t *deviceTracker) seen(e *udisks2.Event) bool {
+	block, err := e.Props.BlockInfo()
+	if err != nil {
+		return true
+	}
+	drive, _ := t.udisks.BlockDrive(e.Path)
+
+	// the preferences might have been changed from the ui
+	if err := t.registry.Reload(); err != nil {
+		log.Println("Cannot reload the device registry:", err)
+	}
+	device, known, err := t.registry.Seen(block.IdUUID, drive.Serial(), time.Now())
+	if err != nil {
+		log.Println("Cannot record device", e.Path, "in the registry:", err)
+	}
+	t.udisks.SetMountPolicy(policyWith(t.policy, t.registry.Devices()))
+
+	if known {
+		name := device.Nickname
+		if name == "" {
+			name = block.IdLabel
+		}
+		if name == "" {
+			name = drive.Model()
+		}
+		t.lock.Lock()
+		t.names[drive.Path] = name
+		t.lock.Unlock()
+	}
+	return device.Automount == nil || *device.Automount
+}
+
+// welcome returns the name of the known device held by the drive, empty if the device
+// was not known.
+func (t *deviceTracker) welcome(drive dbus.ObjectPath) string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	name := t.names[drive]
+	delete(t.names, drive)
+	return name
+}
+
+// policyWith returns the mount policy with the mount options preferred for the devices.
+func policyWith(policy udisks2.MountPolicy, devices []registry.Device) udisks2.MountPolicy {
+	merged := policy
+	merged.Devices = make(map[string][]string)
+	for key, opts := range policy.Devices {
+		merged.Devices[key] = opts
+	}
+	for _, d := range devices {
+		if len(d.MountOptions) == 0 {
+			continue
+		}
+		if d.UUID != "" {
+			merged.Devices[d.UUID] = d.MountOptions
+		} else if d.Serial != "" {
+			merged.Devices[d.Serial] = d.MountOptions
+		}
+	}
+	return merged
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/ubports/ciborium/registry"
+	"github.com/ubports/ciborium/udisks2"
+	. "launchpad.net/gocheck"
+)
+
+var _ = Suite(&DevicesTestSuite{})
+
+type DevicesTestSuite struct{}
+
+func (s *DevicesTestSuite) TestPolicyWith(c *C) {
+	policy := udisks2.MountPolicy{
+		Default: []string{"noexec"},
+		Devices: map[string][]string{"SERIAL0001": {"sync"}},
+	}
+	devices := []registry.Device{
+		{UUID: "1234-ABCD", MountOptions: []string{"ro"}},
+		{Serial: "SERIAL0002", MountOptions: []string{"flush"}},
+		{UUID: "5678-EF01"},
+	}
+
+	merged := policyWith(policy, devices)
+	c.Assert(merged.Devices, DeepEquals, map[string][]string{
+		"SERIAL0001": {"sync"},
+		"1234-ABCD":  {"ro"},
+		"SERIAL0002": {"flush"},
+	})
+	c.Assert(merged.Default, DeepEquals, []string{"noexec"})
+	// the configured policy is left untouched
+	c.Assert(len(policy.Devices), Equals, 1)
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/ubports/ciborium/udisks2"
+	"launchpad.net/go-dbus/v1"
+)
+
+var errUnknownDevice = errors.New("no removable drive holds the device")
+
+// subcommands are run instead of the daemon when named as the first argument.
+var subcommands = map[string]func(args []string) error{
+	"write-image": writeImageCommand,
+	"backup":      backupCommand,
+}
+
+// writeImageCommand writes an image to the drive holding the device file, for example
+// ciborium write-image ubuntu.img.xz /dev/mmcblk1
+func writeImageCommand(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: ciborium write-image IMAGE DEVICE")
+	}
+	image, device := args[0], args[1]
+
+	u, err := storageWatcher()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+	drive, err := findDrive(u.ExternalDrives(), device)
+	if err != nil {
+		return err
+	}
+
+	progress := u.SubscribeImageProgress(udisks2.SubscribeOptions{Buffer: 1, Policy: udisks2.DropOldest})
+	go func() {
+		for p := range progress {
+			step := "Writing"
+			if p.Verifying {
+				step = "Verifying"
+			}
+			fmt.Printf("\r%s %s: %3.0f%%", step, device, p.Percent)
+		}
+	}()
+
+	err = u.WriteImageSync(interruptContext(), drive, image)
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+	fmt.Println(image, "written to", device)
+	return nil
+}
+
+// backupCommand copies the drive holding the device file to an image, for example
+// ciborium backup /dev/mmcblk1 camera.img.gz
+func backupCommand(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: ciborium backup DEVICE IMAGE")
+	}
+	device, image := args[0], args[1]
+
+	u, err := storageWatcher()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+	drive, err := findDrive(u.ExternalDrives(), device)
+	if err != nil {
+		return err
+	}
+
+	progress := u.SubscribeBackupProgress(udisks2.SubscribeOptions{Buffer: 1, Policy: udisks2.DropOldest})
+	go func() {
+		for p := range progress {
+			fmt.Printf("\rBacking up %s: %3.0f%%", device, p.Percent)
+		}
+	}()
+
+	e, err := u.BackupSync(interruptContext(), drive, image)
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+	fmt.Println(device, "backed up to", e.Image, "sha256", e.SHA256)
+	return nil
+}
+
+// storageWatcher returns a watcher that already knows the present drives.
+func storageWatcher() (*udisks2.UDisks2, error) {
+	systemBus, err := dbus.Connect(dbus.SystemBus)
+	if err != nil {
+		return nil, err
+	}
+	u := udisks2.NewStorageWatcher(systemBus, supportedFS...)
+	if err := u.Init(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// interruptContext returns a context that is cancelled on SIGINT or SIGTERM.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-quit
+		cancel()
+	}()
+	return ctx
+}
+
+// findDrive returns the drive with a block device for the device file.
+func findDrive(drives []udisks2.Drive, device string) (*udisks2.Drive, error) {
+	// links such as /dev/disk/by-id are resolved to the device file
+	if p, err := filepath.EvalSymlinks(device); err == nil {
+		device = p
+	}
+	for i := range drives {
+		for _, block := range drives[i].BlockDevices() {
+			if block.Block.Device == device || block.Block.PreferredDevice == device {
+				return &drives[i], nil
+			}
+		}
+	}
+	return nil, errUnknownDevice
+}
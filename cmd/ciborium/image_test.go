@@ -0,0 +1,37 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	. "launchpad.net/gocheck"
+)
+
+var _ = Suite(&ImageTestSuite{})
+
+type ImageTestSuite struct{}
+
+func (s *ImageTestSuite) TestFindDriveUnknownDevice(c *C) {
+	_, err := findDrive(nil, "/dev/mmcblk9")
+	c.Assert(err, Equals, errUnknownDevice)
+}
+
+func (s *ImageTestSuite) TestSubcommands(c *C) {
+	c.Assert(subcommands["write-image"], NotNil)
+	c.Assert(subcommands["backup"], NotNil)
+	c.Assert(writeImageCommand([]string{"card.img"}), ErrorMatches, "usage: .*")
+	c.Assert(backupCommand(nil), ErrorMatches, "usage: .*")
+}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -32,8 +33,10 @@ import (
 
 	"github.com/ubports/ciborium/gettext"
 	"github.com/ubports/ciborium/notifications"
+	"github.com/ubports/ciborium/registry"
 	"github.com/ubports/ciborium/udisks2"
 	"launchpad.net/go-dbus/v1"
+	"launchpad.net/go-xdg/v0"
 )
 
 type message struct{ Summary, Body string }
@@ -104,13 +107,23 @@ var (
 func init() {
 	mw = newMountwatch()
 	mw.set(homeMountpoint, true)
-	supportedFS = []string{"vfat"}
+	supportedFS = []string{udisks2.FilesystemVfat, udisks2.FilesystemExfat, udisks2.FilesystemExt4, udisks2.FilesystemNtfs}
 }
 
 func main() {
 	// set default logger flags to get more useful info
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	// Initialize i18n
 	gettext.SetLocale(gettext.LC_ALL, "")
 	gettext.Textdomain("ciborium")
@@ -143,6 +156,83 @@ func main() {
 			// from the removed device no longer being available
 			Body: gettext.Gettext("Content previously available on this device will no longer be accessible"),
 		}
+
+		msgStorageLocked message = message{
+			// TRANSLATORS: This is the summary of a notification bubble with a short message of
+			// an encrypted storage device being added
+			Summary: gettext.Gettext("Encrypted storage device detected"),
+			// TRANSLATORS: This is the body of a notification bubble with a short message about
+			// unlocking the encrypted storage device to access its content
+			Body: gettext.Gettext("Unlock the device from SD Card Management to access its content"),
+		}
+
+		msgStorageBlocked message = message{
+			// TRANSLATORS: This is the summary of a notification bubble with a short message of
+			// a storage device that is not allowed by the administrator
+			Summary: gettext.Gettext("Storage device blocked"),
+			// TRANSLATORS: This is the body of a notification bubble with a short message about
+			// the content of a blocked storage device not being available
+			Body: gettext.Gettext("This device is not allowed on this system and will not be mounted"),
+		}
+
+		msgStorageErrors = map[error]message{
+			udisks2.ErrBusy: {
+				// TRANSLATORS: This is the summary of a notification bubble with a short message of
+				// failure when the storage device is being used
+				Summary: gettext.Gettext("Storage device is busy"),
+				// TRANSLATORS: This is the body of a notification bubble with a short message with hints
+				// with regards to a storage device that is being used
+				Body: gettext.Gettext("Close any application using the device and try again"),
+			},
+			udisks2.ErrNotAuthorized: {
+				// TRANSLATORS: This is the summary of a notification bubble with a short message of
+				// failure when the operation on a storage device is not allowed
+				Summary: gettext.Gettext("Not authorized"),
+				// TRANSLATORS: This is the body of a notification bubble with a short message with hints
+				// with regards to an operation on a storage device that is not allowed
+				Body: gettext.Gettext("You are not allowed to perform this operation on the storage device"),
+			},
+			udisks2.ErrNotMounted: {
+				// TRANSLATORS: This is the summary of a notification bubble with a short message of
+				// failure when the storage device is not mounted
+				Summary: gettext.Gettext("Storage device is not mounted"),
+				// TRANSLATORS: This is the body of a notification bubble with a short message with hints
+				// with regards to a storage device that is not mounted
+				Body: gettext.Gettext("The content of the storage device is not accessible"),
+			},
+			udisks2.ErrAlreadyMounted: {
+				// TRANSLATORS: This is the summary of a notification bubble with a short message of
+				// failure when the storage device is already mounted
+				Summary: gettext.Gettext("Storage device is already mounted"),
+				// TRANSLATORS: This is the body of a notification bubble with a short message with hints
+				// with regards to a storage device that is already mounted
+				Body: gettext.Gettext("The content of the storage device is already accessible"),
+			},
+			udisks2.ErrCancelled: {
+				// TRANSLATORS: This is the summary of a notification bubble with a short message of
+				// an operation on a storage device being cancelled
+				Summary: gettext.Gettext("Operation cancelled"),
+				// TRANSLATORS: This is the body of a notification bubble with a short message about
+				// an operation on a storage device being cancelled
+				Body: gettext.Gettext("The operation on the storage device was cancelled"),
+			},
+			udisks2.ErrNotSupported: {
+				// TRANSLATORS: This is the summary of a notification bubble with a short message of
+				// failure when the operation is not supported by the storage device
+				Summary: gettext.Gettext("Operation not supported"),
+				// TRANSLATORS: This is the body of a notification bubble with a short message with hints
+				// with regards to an operation not supported by the storage device
+				Body: gettext.Gettext("The storage device does not support this operation"),
+			},
+			udisks2.ErrTimedOut: {
+				// TRANSLATORS: This is the summary of a notification bubble with a short message of
+				// failure when the operation on a storage device took too long
+				Summary: gettext.Gettext("Storage device is not responding"),
+				// TRANSLATORS: This is the body of a notification bubble with a short message with hints
+				// with regards to a storage device that is not responding
+				Body: gettext.Gettext("Remove the storage device and insert it again"),
+			},
+		}
 	)
 
 	var (
@@ -160,16 +250,35 @@ func main() {
 	}
 	log.Print("Using session bus on ", sessionBus.UniqueName)
 
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Println("Not automounting, cannot read the configuration file:", err)
+	}
+
 	udisks2 := udisks2.NewStorageWatcher(systemBus, supportedFS...)
+	udisks2.SetMountPolicy(cfg.MountPolicy)
+	udisks2.SetAutomountRules(cfg.AutomountRules)
 
 	notificationHandler := notifications.NewLegacyHandler(sessionBus, "ciborium")
 	notifyFree := buildFreeNotify(notificationHandler)
 
+	p, err := xdg.Data.Ensure(registryPath)
+	if err != nil {
+		log.Fatal("Cannot create the device registry: ", err)
+	}
+	deviceRegistry, err := registry.Open(p)
+	if err != nil {
+		log.Fatal("Cannot open the device registry: ", err)
+	}
+	devices := newDeviceTracker(udisks2, deviceRegistry, cfg.MountPolicy)
+
 	blockAdded, blockError := udisks2.SubscribeAddEvents()
 	formatCompleted, formatErrors := udisks2.SubscribeFormatEvents()
 	unmountCompleted, unmountErrors := udisks2.SubscribeUnmountEvents()
 	mountCompleted, mountErrors := udisks2.SubscribeMountEvents()
 	mountRemoved := udisks2.SubscribeRemoveEvents()
+	unlockRequired := udisks2.SubscribeUnlockEvents()
+	blocked := udisks2.SubscribeBlockedEvents()
 
 	// create a routine per couple of channels, the select algorithm will make use
 	// ignore some events if more than one channels is being written to the algorithm
@@ -182,16 +291,50 @@ func main() {
 		for {
 			var n *notifications.PushMessage
 			select {
-			case a := <-blockAdded:
+			case a, ok := <-blockAdded:
+				if !ok {
+					return
+				}
+				if !devices.seen(a) {
+					log.Println("Automount disabled for", a.Path)
+					continue
+				}
 				udisks2.Mount(a)
-			case e := <-blockError:
+			case e, ok := <-blockError:
+				if !ok {
+					return
+				}
 				log.Println("Issues in block for added drive:", e)
+				msg := errorMessage(msgStorageErrors, e, msgStorageFail)
 				n = notificationHandler.NewStandardPushMessage(
-					msgStorageFail.Summary,
-					msgStorageFail.Body,
+					msg.Summary,
+					msg.Body,
 					errorIcon,
 				)
-			case m := <-mountRemoved:
+			case l, ok := <-unlockRequired:
+				if !ok {
+					return
+				}
+				log.Println("Encrypted block", l.Path, "must be unlocked")
+				n = notificationHandler.NewStandardPushMessage(
+					msgStorageLocked.Summary,
+					msgStorageLocked.Body,
+					sdCardIcon,
+				)
+			case b, ok := <-blocked:
+				if !ok {
+					return
+				}
+				log.Println("Block", b.Path, "is not allowed")
+				n = notificationHandler.NewStandardPushMessage(
+					msgStorageBlocked.Summary,
+					msgStorageBlocked.Body,
+					errorIcon,
+				)
+			case m, ok := <-mountRemoved:
+				if !ok {
+					return
+				}
 				log.Println("Path removed", m)
 				n = notificationHandler.NewStandardPushMessage(
 					msgStorageRemoved.Summary,
@@ -221,10 +364,19 @@ func main() {
 		for {
 			var n *notifications.PushMessage
 			select {
-			case m := <-mountCompleted:
+			case m, ok := <-mountCompleted:
+				if !ok {
+					return
+				}
 				log.Println("Mounted", m)
+				summary := msgStorageSuccess.Summary
+				if name := devices.welcome(m.Path); name != "" {
+					// TRANSLATORS: This is the summary of a notification bubble with a short message of
+					// success when adding a storage device that was seen before, %s is its name
+					summary = fmt.Sprintf(gettext.Gettext("Welcome back, %s"), name)
+				}
 				n = notificationHandler.NewStandardPushMessage(
-					msgStorageSuccess.Summary,
+					summary,
 					msgStorageSuccess.Body,
 					sdCardIcon,
 				)
@@ -234,15 +386,22 @@ func main() {
 				}
 
 				mw.set(mountpoint(m.Mountpoint), true)
-			case e := <-mountErrors:
+			case e, ok := <-mountErrors:
+				if !ok {
+					return
+				}
 				log.Println("Error while mounting device", e)
 
+				msg := errorMessage(msgStorageErrors, e, msgStorageFail)
 				n = notificationHandler.NewStandardPushMessage(
-					msgStorageFail.Summary,
-					msgStorageFail.Body,
+					msg.Summary,
+					msg.Body,
 					errorIcon,
 				)
-			case m := <-unmountCompleted:
+			case m, ok := <-unmountCompleted:
+				if !ok {
+					return
+				}
 				log.Println("Path removed", m)
 				n = notificationHandler.NewStandardPushMessage(
 					msgStorageRemoved.Summary,
@@ -250,12 +409,16 @@ func main() {
 					sdCardIcon,
 				)
 				mw.remove(mountpoint(m))
-			case e := <-unmountErrors:
+			case e, ok := <-unmountErrors:
+				if !ok {
+					return
+				}
 				log.Println("Error while unmounting device", e)
 
+				msg := errorMessage(msgStorageErrors, e, msgStorageFail)
 				n = notificationHandler.NewStandardPushMessage(
-					msgStorageFail.Summary,
-					msgStorageFail.Body,
+					msg.Summary,
+					msg.Body,
 					errorIcon,
 				)
 			}
@@ -274,14 +437,21 @@ func main() {
 		for {
 			var n *notifications.PushMessage
 			select {
-			case f := <-formatCompleted:
+			case f, ok := <-formatCompleted:
+				if !ok {
+					return
+				}
 				log.Println("Format done. Trying to mount.")
 				udisks2.Mount(f)
-			case e := <-formatErrors:
+			case e, ok := <-formatErrors:
+				if !ok {
+					return
+				}
 				log.Println("There was an error while formatting", e)
+				msg := errorMessage(msgStorageErrors, e, msgStorageFail)
 				n = notificationHandler.NewStandardPushMessage(
-					msgStorageFail.Summary,
-					msgStorageFail.Body,
+					msg.Summary,
+					msg.Body,
 					errorIcon,
 				)
 			}
@@ -298,8 +468,24 @@ func main() {
 		log.Fatal("Cannot monitor storage devices:", err)
 	}
 
-	done := make(chan bool)
-	<-done
+	// stop watching the storage devices when asked to quit so that the signal
+	// watches are cancelled
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+	log.Println("Received", sig, "shutting down")
+	udisks2.Close()
+}
+
+// errorMessage returns the message for the known error or fallback for any other error.
+func errorMessage(msgs map[error]message, err error, fallback message) message {
+	if udisks2.IsBusy(err) {
+		err = udisks2.ErrBusy
+	}
+	if msg, ok := msgs[err]; ok {
+		return msg
+	}
+	return fallback
 }
 
 // createStandardHomeDirs creates directories reflecting a standard home, these
@@ -0,0 +1,39 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+
+	"github.com/ubports/ciborium/udisks2"
+	. "launchpad.net/gocheck"
+)
+
+var _ = Suite(&ErrorMessageTestSuite{})
+
+type ErrorMessageTestSuite struct{}
+
+func (s *ErrorMessageTestSuite) TestErrorMessage(c *C) {
+	busy := message{"Busy", "Close applications"}
+	fallback := message{"Failed", "Try again"}
+	msgs := map[error]message{udisks2.ErrBusy: busy}
+
+	c.Assert(errorMessage(msgs, udisks2.ErrBusy, fallback), Equals, busy)
+	c.Assert(errorMessage(msgs, &udisks2.BusyError{Mountpoint: "/media/phablet/CAMERA"}, fallback), Equals, busy)
+	c.Assert(errorMessage(msgs, udisks2.ErrTimedOut, fallback), Equals, fallback)
+	c.Assert(errorMessage(msgs, errors.New("unknown"), fallback), Equals, fallback)
+}
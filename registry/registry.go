@@ -0,0 +1,171 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package registry remembers the storage devices that have been seen and the
+// preferences of the user for each of them.
+package registry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Device holds what is known about a storage device, it is identified by the UUID of
+// its filesystem or, when there is none, by the serial of its drive.
+type Device struct {
+	UUID      string    `json:"uuid,omitempty"`
+	Serial    string    `json:"serial,omitempty"`
+	Nickname  string    `json:"nickname,omitempty"`
+	FirstSeen time.Time `json:"first-seen"`
+	LastSeen  time.Time `json:"last-seen"`
+	// MountOptions replace the options of the mount policy when not empty.
+	MountOptions []string `json:"mount-options,omitempty"`
+	// Automount overrides the automount rules when set.
+	Automount *bool `json:"automount,omitempty"`
+}
+
+func (d *Device) matches(uuid, serial string) bool {
+	if d.UUID != "" || uuid != "" {
+		return strings.EqualFold(d.UUID, uuid)
+	}
+	return serial != "" && d.Serial == serial
+}
+
+// Registry is a set of devices persisted in a JSON file.
+type Registry struct {
+	path    string
+	lock    sync.Mutex
+	devices []Device
+}
+
+// Open loads the registry stored in the file, a missing file is an empty registry.
+func Open(path string) (*Registry, error) {
+	r := &Registry{path: path}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the file again to get the changes done by other processes.
+func (r *Registry) Reload() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	data, err := ioutil.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		r.devices = nil
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var devices []Device
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return err
+	}
+	r.devices = devices
+	return nil
+}
+
+// Devices returns all the known devices.
+func (r *Registry) Devices() []Device {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	devices := make([]Device, len(r.devices))
+	copy(devices, r.devices)
+	return devices
+}
+
+// Lookup returns the device with the filesystem UUID or the drive serial.
+func (r *Registry) Lookup(uuid, serial string) (Device, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if i := r.find(uuid, serial); i >= 0 {
+		return r.devices[i], true
+	}
+	return Device{}, false
+}
+
+// Seen records that the device was seen at the given time, adding it if it is not known.
+// The device as it was before is returned together with whether it was known.
+func (r *Registry) Seen(uuid, serial string, now time.Time) (Device, bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	i := r.find(uuid, serial)
+	if i < 0 {
+		r.devices = append(r.devices, Device{UUID: uuid, Serial: serial, FirstSeen: now})
+		i = len(r.devices) - 1
+	}
+	previous := r.devices[i]
+	r.devices[i].LastSeen = now
+	if serial != "" {
+		r.devices[i].Serial = serial
+	}
+	return previous, !previous.LastSeen.IsZero(), r.save()
+}
+
+// Update stores the preferences of the device, which has to be known.
+func (r *Registry) Update(d Device) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	i := r.find(d.UUID, d.Serial)
+	if i < 0 {
+		return os.ErrNotExist
+	}
+	r.devices[i].Nickname = d.Nickname
+	r.devices[i].MountOptions = d.MountOptions
+	r.devices[i].Automount = d.Automount
+	return r.save()
+}
+
+func (r *Registry) find(uuid, serial string) int {
+	if uuid == "" && serial == "" {
+		return -1
+	}
+	for i := range r.devices {
+		if r.devices[i].matches(uuid, serial) {
+			return i
+		}
+	}
+	return -1
+}
+
+// save writes the registry to a temporary file that replaces the old one so that readers
+// never see a partial file.
+func (r *Registry) save() error {
+	data, err := json.MarshalIndent(r.devices, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), ".devices")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package registry
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "launchpad.net/gocheck"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type RegistryTestSuite struct {
+	path string
+	reg  *Registry
+}
+
+var _ = Suite(&RegistryTestSuite{})
+
+func (s *RegistryTestSuite) SetUpTest(c *C) {
+	s.path = filepath.Join(c.MkDir(), "devices.json")
+	var err error
+	s.reg, err = Open(s.path)
+	c.Assert(err, IsNil)
+}
+
+func (s *RegistryTestSuite) TestSeenNewDevice(c *C) {
+	now := time.Date(2015, 3, 2, 10, 0, 0, 0, time.UTC)
+	_, known, err := s.reg.Seen("1234-ABCD", "SERIAL0001", now)
+	c.Assert(err, IsNil)
+	c.Assert(known, Equals, false)
+
+	d, ok := s.reg.Lookup("1234-abcd", "")
+	c.Assert(ok, Equals, true)
+	c.Assert(d.FirstSeen.Equal(now), Equals, true)
+	c.Assert(d.LastSeen.Equal(now), Equals, true)
+}
+
+func (s *RegistryTestSuite) TestSeenKnownDevice(c *C) {
+	first := time.Date(2015, 3, 2, 10, 0, 0, 0, time.UTC)
+	later := first.Add(24 * time.Hour)
+	_, _, err := s.reg.Seen("1234-ABCD", "SERIAL0001", first)
+	c.Assert(err, IsNil)
+
+	previous, known, err := s.reg.Seen("1234-ABCD", "SERIAL0001", later)
+	c.Assert(err, IsNil)
+	c.Assert(known, Equals, true)
+	c.Assert(previous.LastSeen.Equal(first), Equals, true)
+	c.Assert(len(s.reg.Devices()), Equals, 1)
+}
+
+func (s *RegistryTestSuite) TestSerialOnlyDevice(c *C) {
+	_, _, err := s.reg.Seen("", "SERIAL0001", time.Now())
+	c.Assert(err, IsNil)
+	_, ok := s.reg.Lookup("", "SERIAL0001")
+	c.Assert(ok, Equals, true)
+	// a formatted card gets a new UUID and is a new device
+	_, ok = s.reg.Lookup("5678-EF01", "SERIAL0001")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *RegistryTestSuite) TestUpdatePersists(c *C) {
+	_, _, err := s.reg.Seen("1234-ABCD", "", time.Now())
+	c.Assert(err, IsNil)
+	automount := false
+	err = s.reg.Update(Device{UUID: "1234-ABCD", Nickname: "Camera card", MountOptions: []string{"ro"}, Automount: &automount})
+	c.Assert(err, IsNil)
+
+	reg, err := Open(s.path)
+	c.Assert(err, IsNil)
+	d, ok := reg.Lookup("1234-ABCD", "")
+	c.Assert(ok, Equals, true)
+	c.Assert(d.Nickname, Equals, "Camera card")
+	c.Assert(d.MountOptions, DeepEquals, []string{"ro"})
+	c.Assert(*d.Automount, Equals, false)
+}
+
+func (s *RegistryTestSuite) TestUpdateUnknown(c *C) {
+	c.Assert(s.reg.Update(Device{UUID: "1234-ABCD"}), NotNil)
+}
@@ -0,0 +1,185 @@
+import QtQuick 2.9
+import Ubuntu.Components 1.3
+import Ubuntu.Components.Popups 1.3
+
+Dialog {
+    id: backupDlg
+    property int driveIndex
+
+    TextField {
+        id: imageField
+        placeholderText: i18n.tr("Image file (.img, .img.gz or .img.xz)")
+        inputMethodHints: Qt.ImhNoAutoUppercase | Qt.ImhNoPredictiveText
+        text: driveCtrl.driveBackupPath(backupDlg.driveIndex)
+    }
+
+    Button {
+        id: okButton
+        text: i18n.tr("Back up")
+        color: theme.palette.normal.positive
+        enabled: backupDlg.state != "confirm" || imageField.text.length > 0
+        onClicked: {
+            switch (backupDlg.state) {
+            case "confirm":
+                console.log("Backing up to", imageField.text);
+                driveCtrl.driveBackup(backupDlg.driveIndex, imageField.text);
+                d.confirmed = true;
+                return;
+            case "done":
+                console.log("Backup complete");
+                break;
+            case "cancelled":
+                console.log("Backup was cancelled");
+                break;
+            case "error":
+                console.log("Error backing up!");
+                break;
+            default:
+                console.warn("Ok button clicked in wrong state: ", backupDlg.state);
+                break;
+            }
+            PopupUtils.close(backupDlg);
+        }
+    }
+
+    Button {
+        id: cancelButton
+        text: i18n.tr("Cancel")
+        onClicked: {
+            if (backupDlg.state == "backup") {
+                console.log("Cancelling backup in progress");
+                driveCtrl.driveBackupCancel();
+                return;
+            }
+            console.log("Back up action cancelled");
+            PopupUtils.close(backupDlg);
+        }
+    }
+
+    ProgressBar {
+        id: backupProgress
+        visible: false
+        minimumValue: 0
+        maximumValue: 1
+        value: driveCtrl.backupProgress
+    }
+
+    state: "confirm"
+    states: [
+        State {
+            name: "confirm"
+            PropertyChanges {
+                target: backupDlg
+                explicit: true
+                title: i18n.tr("Back up")
+                text: i18n.tr("Files on the device can't be accessed while it is backed up")
+            }
+        },
+        State {
+            name: "backup"
+            when: d.confirmed && driveCtrl.backingUp
+            PropertyChanges {
+                target: backupDlg
+                explicit: true
+                title: i18n.tr("Backing up")
+                text: ""
+            }
+            PropertyChanges {
+                target: imageField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: backupProgress
+                explicit: true
+                visible: true
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "done"
+            when: d.confirmed && !driveCtrl.backingUp && !driveCtrl.backupError && !driveCtrl.backupCancelled
+            PropertyChanges {
+                target: backupDlg
+                explicit: true
+                title: i18n.tr("Backup Complete")
+                text: i18n.tr("The device was backed up to %1").arg(driveCtrl.backupImage)
+            }
+            PropertyChanges {
+                target: imageField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                text: i18n.tr("Ok")
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "cancelled"
+            when: d.confirmed && !driveCtrl.backingUp && driveCtrl.backupCancelled
+            PropertyChanges {
+                target: backupDlg
+                explicit: true
+                title: i18n.tr("Backup Cancelled")
+                text: i18n.tr("No image was written")
+            }
+            PropertyChanges {
+                target: imageField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                text: i18n.tr("Ok")
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "error"
+            when: d.confirmed && !driveCtrl.backingUp && driveCtrl.backupError
+            PropertyChanges {
+                target: backupDlg
+                explicit: true
+                title: i18n.tr("Backup Error")
+                text: i18n.tr("The device could not be backed up")
+            }
+            PropertyChanges {
+                target: imageField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                text: i18n.tr("Ok")
+                color: theme.palette.normal.overlaySecondaryText
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        }
+    ]
+
+    QtObject {
+        id: d
+        property bool confirmed: false
+    }
+}
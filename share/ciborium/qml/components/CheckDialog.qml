@@ -0,0 +1,153 @@
+import QtQuick 2.9
+import Ubuntu.Components 1.3
+import Ubuntu.Components.Popups 1.3
+
+Dialog {
+    id: checkDlg
+    property int driveIndex
+
+    Button {
+        id: okButton
+        text: i18n.tr("Continue")
+        color: theme.palette.normal.positive
+        onClicked: {
+            switch (checkDlg.state) {
+            case "confirm":
+                console.log("Check confirmed");
+                driveCtrl.driveCheck(checkDlg.driveIndex);
+                d.confirmed = true;
+                return;
+            case "clean":
+            case "repaired":
+                console.log("Check complete");
+                break;
+            case "error":
+                console.log("Error checking!");
+                break;
+            default:
+                console.warn("Ok button clicked in wrong state: ", checkDlg.state);
+                break;
+            }
+            PopupUtils.close(checkDlg);
+        }
+    }
+
+    Button {
+        id: cancelButton
+        text: i18n.tr("Cancel")
+        onClicked: {
+            console.log("Check action cancelled");
+            PopupUtils.close(checkDlg);
+        }
+    }
+
+    ActivityIndicator {
+        id: checkActivity
+        running: false
+        visible: running
+    }
+
+    state: "confirm"
+    states: [
+        State {
+            name: "confirm"
+            PropertyChanges {
+                target: checkDlg
+                explicit: true
+                title: i18n.tr("Check and repair")
+                text: i18n.tr("Files on the device can't be accessed while it is checked")
+            }
+        },
+        State {
+            name: "checking"
+            when: d.confirmed && driveCtrl.checking
+            PropertyChanges {
+                target: checkDlg
+                explicit: true
+                title: i18n.tr("Checking")
+                text: ""
+            }
+            PropertyChanges {
+                target: checkActivity
+                explicit: true
+                running: true
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "clean"
+            when: d.confirmed && !driveCtrl.checking && !driveCtrl.checkError && !driveCtrl.checkRepaired
+            PropertyChanges {
+                target: checkDlg
+                explicit: true
+                title: i18n.tr("Check Complete")
+                text: i18n.tr("No errors were found on the device")
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                text: i18n.tr("Ok")
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "repaired"
+            when: d.confirmed && !driveCtrl.checking && !driveCtrl.checkError && driveCtrl.checkRepaired
+            PropertyChanges {
+                target: checkDlg
+                explicit: true
+                title: i18n.tr("Repair Complete")
+                text: i18n.tr("The errors found on the device were repaired")
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                text: i18n.tr("Ok")
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "error"
+            when: d.confirmed && !driveCtrl.checking && driveCtrl.checkError
+            PropertyChanges {
+                target: checkDlg
+                explicit: true
+                title: i18n.tr("Check Error")
+                text: i18n.tr("The device could not be checked or repaired, it might need to be formatted")
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                text: i18n.tr("Ok")
+                color: theme.palette.normal.overlaySecondaryText
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        }
+    ]
+
+    QtObject {
+        id: d
+        property bool confirmed: false
+    }
+}
@@ -8,16 +8,22 @@ ListItem {
     property int driveIndex
 
     signal formatClicked()
+    signal unlockClicked()
+    signal checkClicked()
+    signal renameClicked()
+    signal writeImageClicked()
+    signal backupClicked()
     signal safeRemovalClicked()
 
     width: parent.width
     height: layout.implicitHeight
-    expansion.height: layout.implicitHeight + buttonRow.height + units.gu(3)
+    expansion.height: layout.implicitHeight + detailsLabel.height + buttonRow.height + units.gu(3)
     onClicked: expansion.expanded = !expansion.expanded
 
     ListItemLayout {
         id: layout
-        title.text: driveCtrl.driveModel(index)
+        title.text: driveCtrl.driveNickname(index) || driveCtrl.driveLabel(index) || driveCtrl.driveModel(index)
+        subtitle.text: title.text != driveCtrl.driveModel(index) ? driveCtrl.driveModel(index) : ""
 
         Icon {
             height: units.gu(4)
@@ -33,11 +39,26 @@ ListItem {
         }
     }
 
+    Label {
+        id: detailsLabel
+        anchors {
+            left: parent.left
+            top: layout.bottom
+            right: parent.right
+            leftMargin: units.gu(2)
+            rightMargin: units.gu(2)
+        }
+        visible: driveDelegate.expansion.expanded
+        text: driveCtrl.driveDetails(index)
+        textSize: Label.Small
+        elide: Text.ElideRight
+    }
+
     RowLayout {
         id: buttonRow
         anchors {
             left: parent.left
-            top: layout.bottom
+            top: detailsLabel.bottom
             right: parent.right
             margins: units.gu(1)
         }
@@ -50,11 +71,45 @@ ListItem {
             Layout.fillWidth: true
         }
 
+        Button {
+            text: i18n.tr("Unlock")
+            visible: driveCtrl.driveLocked(index)
+            onClicked: unlockClicked()
+        }
+
+        Button {
+            text: i18n.tr("Rename")
+            visible: !driveCtrl.driveLocked(index)
+            onClicked: renameClicked()
+        }
+
+        Button {
+            text: i18n.tr("Check and repair")
+            visible: !driveCtrl.driveLocked(index)
+            onClicked: checkClicked()
+        }
+
         Button {
             text: i18n.tr("Format")
             onClicked: formatClicked()
         }
 
+        Button {
+            text: i18n.tr("Back up")
+            onClicked: backupClicked()
+        }
+
+        Button {
+            text: i18n.tr("Write image")
+            onClicked: writeImageClicked()
+        }
+
+        Button {
+            text: i18n.tr("Eject")
+            visible: driveCtrl.driveEjectable(index)
+            onClicked: driveCtrl.driveEject(index)
+        }
+
         Button {
             text: i18n.tr("Safely Remove")
             color: theme.palette.selected.focus
@@ -10,16 +10,26 @@ Button {
         id: okBtn
         text: i18n.tr("Continue with format")
         color: theme.palette.normal.negative
+        enabled: formatDlg.state != "confirm" || !encryptCheck.checked || (passphraseField.text.length > 0 && passphraseField.text == passphraseConfirmField.text)
         onClicked: {
             switch(formatDlg.state) {
             case "confirm":
                 console.log("Format confirmed");
-                driveCtrl.driveFormat(formatDlg.driveIndex);
+                if (encryptCheck.checked) {
+                    driveCtrl.driveFormatEncrypted(formatDlg.driveIndex, passphraseField.text);
+                    passphraseField.text = "";
+                    passphraseConfirmField.text = "";
+                } else {
+                    driveCtrl.driveFormat(formatDlg.driveIndex);
+                }
                 d.confirmed = true;
                 return;
             case "finished":
                 console.log("Format completed");
                 break;
+            case "cancelled":
+                console.log("Format was cancelled");
+                break;
             case "error":
                 console.log("Error formatting!");
                 break;
@@ -35,18 +45,60 @@ Button {
         id: cancelBtn
         text: i18n.tr("Cancel")
         onClicked: {
+            if (formatDlg.state == "format") {
+                console.log("Cancelling format in progress")
+                driveCtrl.driveFormatCancel()
+                return
+            }
             console.log("Format cancelled")
             PopupUtils.close(formatDlg)
         }
     }
     
 
+    Row {
+        id: encryptRow
+        spacing: units.gu(1)
+
+        CheckBox {
+            id: encryptCheck
+            checked: false
+        }
+
+        Label {
+            anchors.verticalCenter: encryptCheck.verticalCenter
+            text: i18n.tr("Encrypt the device")
+        }
+    }
+
+    TextField {
+        id: passphraseField
+        visible: encryptRow.visible && encryptCheck.checked
+        placeholderText: i18n.tr("Passphrase")
+        echoMode: TextInput.Password
+    }
+
+    TextField {
+        id: passphraseConfirmField
+        visible: passphraseField.visible
+        placeholderText: i18n.tr("Confirm passphrase")
+        echoMode: TextInput.Password
+    }
+
     ActivityIndicator {
         id: formatActivity
         running: false
         visible:  running
     }
 
+    ProgressBar {
+        id: formatProgress
+        visible: false
+        minimumValue: 0
+        maximumValue: 1
+        value: driveCtrl.formatProgress
+    }
+
     state: "confirm"
     states: [
         State {
@@ -61,6 +113,10 @@ Button {
         State {
             name: "format"
             when: d.confirmed && driveCtrl.formatting && !driveCtrl.formatError
+            PropertyChanges {
+                target: encryptRow
+                visible: false
+            }
             PropertyChanges {
                 target: formatDlg
                 explicit: true
@@ -69,7 +125,7 @@ Button {
             }
             PropertyChanges {
                 target: cancelBtn
-                visible: false
+                visible: true
             }
             PropertyChanges {
                 target: okBtn
@@ -77,12 +133,20 @@ Button {
             }
             PropertyChanges {
                 target: formatActivity
-                running: true
+                running: !driveCtrl.formatProgressValid
+            }
+            PropertyChanges {
+                target: formatProgress
+                visible: driveCtrl.formatProgressValid
             }
         },
         State {
             name: "finish"
-            when: d.confirmed && !driveCtrl.formatting && !driveCtrl.formatError
+            when: d.confirmed && !driveCtrl.formatting && !driveCtrl.formatError && !driveCtrl.formatCancelled
+            PropertyChanges {
+                target: encryptRow
+                visible: false
+            }
             PropertyChanges {
                 target: formatDlg
                 explicit: true
@@ -104,9 +168,41 @@ Button {
                 running: false
             }
         },
+        State {
+            name: "cancelled"
+            when: d.confirmed && driveCtrl.formatCancelled
+            PropertyChanges {
+                target: encryptRow
+                visible: false
+            }
+            PropertyChanges {
+                target: formatDlg
+                explicit: true
+                title: i18n.tr("Format Cancelled")
+                text: i18n.tr("The device might need to be formatted before it can be used again")
+            }
+            PropertyChanges {
+                target: cancelBtn
+                visible: false
+            }
+            PropertyChanges {
+                target: okBtn
+                visible: true
+                text: i18n.tr("Ok")
+                color: theme.palette.normal.overlaySecondaryText
+            }
+            PropertyChanges {
+                target: formatActivity
+                running: false
+            }
+        },
         State {
             name: "error"
             when: d.confirmed && driveCtrl.formatError
+            PropertyChanges {
+                target: encryptRow
+                visible: false
+            }
             PropertyChanges {
                 target: formatDlg
                 explicit: true
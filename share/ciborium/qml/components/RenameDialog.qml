@@ -0,0 +1,156 @@
+import QtQuick 2.9
+import Ubuntu.Components 1.3
+import Ubuntu.Components.Popups 1.3
+
+Dialog {
+    id: renameDlg
+    property int driveIndex
+
+    TextField {
+        id: nicknameField
+        placeholderText: i18n.tr("Nickname")
+        text: driveCtrl.driveNickname(renameDlg.driveIndex)
+    }
+
+    TextField {
+        id: labelField
+        placeholderText: i18n.tr("Label")
+        text: driveCtrl.driveLabel(renameDlg.driveIndex)
+        onAccepted: okButton.clicked()
+    }
+
+    Button {
+        id: okButton
+        text: i18n.tr("Rename")
+        color: theme.palette.normal.positive
+        onClicked: {
+            switch (renameDlg.state) {
+            case "rename":
+            case "error":
+                console.log("Renaming drive");
+                driveCtrl.driveSetNickname(renameDlg.driveIndex, nicknameField.text);
+                if (labelField.text == driveCtrl.driveLabel(renameDlg.driveIndex)) {
+                    break;
+                }
+                driveCtrl.driveSetLabel(renameDlg.driveIndex, labelField.text);
+                d.confirmed = true;
+                return;
+            case "finish":
+                console.log("Rename complete");
+                break;
+            default:
+                console.warn("Ok button clicked in wrong state: ", renameDlg.state);
+                break;
+            }
+            PopupUtils.close(renameDlg);
+        }
+    }
+
+    Button {
+        id: cancelButton
+        text: i18n.tr("Cancel")
+        onClicked: {
+            console.log("Rename action cancelled");
+            PopupUtils.close(renameDlg);
+        }
+    }
+
+    ActivityIndicator {
+        id: renameActivity
+        running: false
+        visible: running
+    }
+
+    state: "rename"
+    states: [
+        State {
+            name: "rename"
+            PropertyChanges {
+                target: renameDlg
+                explicit: true
+                title: i18n.tr("Rename")
+                text: i18n.tr("Enter the new nickname and label of the device")
+            }
+        },
+        State {
+            name: "renaming"
+            when: d.confirmed && driveCtrl.renaming
+            PropertyChanges {
+                target: renameDlg
+                explicit: true
+                title: i18n.tr("Renaming")
+                text: ""
+            }
+            PropertyChanges {
+                target: renameActivity
+                explicit: true
+                running: true
+            }
+            PropertyChanges {
+                target: nicknameField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: labelField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "finish"
+            when: d.confirmed && !driveCtrl.renaming && !driveCtrl.renameError
+            PropertyChanges {
+                target: renameDlg
+                explicit: true
+                title: i18n.tr("Rename Complete")
+                text: ""
+            }
+            PropertyChanges {
+                target: nicknameField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: labelField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                text: i18n.tr("Ok")
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "error"
+            when: d.confirmed && !driveCtrl.renaming && driveCtrl.renameError
+            PropertyChanges {
+                target: renameDlg
+                explicit: true
+                title: i18n.tr("Rename Error")
+                text: i18n.tr("The label is not valid for the device, FAT labels can have at most 11 characters")
+            }
+        }
+    ]
+
+    QtObject {
+        id: d
+        property bool confirmed: false
+    }
+}
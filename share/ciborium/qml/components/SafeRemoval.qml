@@ -20,6 +20,9 @@ Dialog {
             case "finish":
                 console.log("Safe removal complete");
                 break;
+            case "detached":
+                console.log("Device detached while still in use");
+                break;
             case "error":
                 console.log("Error removing!");
                 break;
@@ -31,6 +34,17 @@ Dialog {
         }
     }
     
+    Button {
+        id: forceButton
+        text: i18n.tr("Force remove")
+        color: theme.palette.normal.negative
+        visible: false
+        onClicked: {
+            console.log("Forcing safe removal");
+            driveCtrl.driveForceUnmount(safeRemovalDlg.driveIndex);
+        }
+    }
+
     Button {
         id: cancelButton
         text: i18n.tr("Cancel")
@@ -59,7 +73,7 @@ Dialog {
         },
         State {
             name: "unmount"
-            when: d.confirmed && driveCtrl.unmounting && !driveCtrl.unmountError
+            when: d.confirmed && !driveCtrl.readyToRemove && !driveCtrl.detached && !driveCtrl.unmountError
             PropertyChanges {
                 target: safeRemovalDlg
                 explicit: true
@@ -84,7 +98,7 @@ Dialog {
         },
         State {
             name: "finish"
-            when: d.confirmed && !driveCtrl.unmounting && !driveCtrl.unmountError
+            when: d.confirmed && driveCtrl.readyToRemove && !driveCtrl.unmountError
             PropertyChanges {
                 target: safeRemovalDlg
                 explicit: true
@@ -102,6 +116,28 @@ Dialog {
                 visible: false
             }
         },
+        State {
+            name: "detached"
+            when: d.confirmed && driveCtrl.detached && !driveCtrl.unmountError
+            PropertyChanges {
+                target: safeRemovalDlg
+                explicit: true
+                title: i18n.tr("Device still in use")
+                text: i18n.tr("Applications can still write to the device, close them before removing it")
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                visible: true
+                text: i18n.tr("Ok")
+                color: theme.palette.normal.overlaySecondaryText
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
         State {
             name: "error"
             when: d.confirmed && driveCtrl.unmountError
@@ -109,7 +145,9 @@ Dialog {
                 target: safeRemovalDlg
                 explicit: true
                 title: i18n.tr("Unmount Error");
-                text: i18n.tr("The device could not be unmounted because it is busy");
+                text: driveCtrl.unmountBusy != ""
+                      ? i18n.tr("%1 is still using this card").arg(driveCtrl.unmountBusy)
+                      : i18n.tr("The device could not be unmounted because it is busy");
             }
             PropertyChanges {
                 target: okButton
@@ -118,6 +156,11 @@ Dialog {
                 text: i18n.tr("Ok")
                 color: theme.palette.normal.overlaySecondaryText
             }
+            PropertyChanges {
+                target: forceButton
+                explicit: true
+                visible: true
+            }
             PropertyChanges {
                 target: cancelButton
                 explicit: true
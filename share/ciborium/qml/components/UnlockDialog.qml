@@ -0,0 +1,139 @@
+import QtQuick 2.9
+import Ubuntu.Components 1.3
+import Ubuntu.Components.Popups 1.3
+
+Dialog {
+    id: unlockDlg
+    property int driveIndex
+
+    TextField {
+        id: passphraseField
+        placeholderText: i18n.tr("Passphrase")
+        echoMode: TextInput.Password
+        onAccepted: okButton.clicked()
+    }
+
+    Button {
+        id: okButton
+        text: i18n.tr("Unlock")
+        color: theme.palette.normal.positive
+        enabled: passphraseField.text.length > 0
+        onClicked: {
+            switch (unlockDlg.state) {
+            case "unlock":
+            case "error":
+                console.log("Unlocking drive");
+                driveCtrl.driveUnlock(unlockDlg.driveIndex, passphraseField.text);
+                passphraseField.text = "";
+                d.confirmed = true;
+                return;
+            case "finish":
+                console.log("Unlock complete");
+                break;
+            default:
+                console.warn("Ok button clicked in wrong state: ", unlockDlg.state);
+                break;
+            }
+            PopupUtils.close(unlockDlg);
+        }
+    }
+
+    Button {
+        id: cancelButton
+        text: i18n.tr("Cancel")
+        onClicked: {
+            console.log("Unlock action cancelled");
+            PopupUtils.close(unlockDlg);
+        }
+    }
+
+    ActivityIndicator {
+        id: unlockActivity
+        running: false
+        visible: running
+    }
+
+    state: "unlock"
+    states: [
+        State {
+            name: "unlock"
+            PropertyChanges {
+                target: unlockDlg
+                explicit: true
+                title: i18n.tr("Unlock")
+                text: i18n.tr("Enter the passphrase of the encrypted device")
+            }
+        },
+        State {
+            name: "unlocking"
+            when: d.confirmed && driveCtrl.unlocking
+            PropertyChanges {
+                target: unlockDlg
+                explicit: true
+                title: i18n.tr("Unlocking")
+                text: ""
+            }
+            PropertyChanges {
+                target: unlockActivity
+                explicit: true
+                running: true
+            }
+            PropertyChanges {
+                target: passphraseField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "finish"
+            when: d.confirmed && !driveCtrl.unlocking && !driveCtrl.unlockError
+            PropertyChanges {
+                target: unlockDlg
+                explicit: true
+                title: i18n.tr("Unlocked")
+                text: i18n.tr("The device content is now accessible")
+            }
+            PropertyChanges {
+                target: passphraseField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                text: i18n.tr("Ok")
+                enabled: true
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "error"
+            when: d.confirmed && !driveCtrl.unlocking && driveCtrl.unlockError
+            PropertyChanges {
+                target: unlockDlg
+                explicit: true
+                title: i18n.tr("Unlock Error")
+                text: i18n.tr("The device could not be unlocked, check the passphrase and try again")
+            }
+        }
+    ]
+
+    QtObject {
+        id: d
+        property bool confirmed: false
+    }
+}
@@ -0,0 +1,157 @@
+import QtQuick 2.9
+import Ubuntu.Components 1.3
+import Ubuntu.Components.Popups 1.3
+
+Dialog {
+    id: writeImageDlg
+    property int driveIndex
+
+    TextField {
+        id: imageField
+        placeholderText: i18n.tr("Image file (.img, .img.gz or .img.xz)")
+        inputMethodHints: Qt.ImhNoAutoUppercase | Qt.ImhNoPredictiveText
+    }
+
+    Button {
+        id: okButton
+        text: i18n.tr("Write")
+        color: theme.palette.normal.negative
+        enabled: writeImageDlg.state != "confirm" || imageField.text.length > 0
+        onClicked: {
+            switch (writeImageDlg.state) {
+            case "confirm":
+                console.log("Writing image", imageField.text);
+                driveCtrl.driveWriteImage(writeImageDlg.driveIndex, imageField.text);
+                d.confirmed = true;
+                return;
+            case "done":
+                console.log("Image written");
+                break;
+            case "error":
+                console.log("Error writing image!");
+                break;
+            default:
+                console.warn("Ok button clicked in wrong state: ", writeImageDlg.state);
+                break;
+            }
+            PopupUtils.close(writeImageDlg);
+        }
+    }
+
+    Button {
+        id: cancelButton
+        text: i18n.tr("Cancel")
+        onClicked: {
+            console.log("Write image action cancelled");
+            PopupUtils.close(writeImageDlg);
+        }
+    }
+
+    ProgressBar {
+        id: writeProgress
+        visible: false
+        minimumValue: 0
+        maximumValue: 1
+        value: driveCtrl.writeProgress
+    }
+
+    state: "confirm"
+    states: [
+        State {
+            name: "confirm"
+            PropertyChanges {
+                target: writeImageDlg
+                explicit: true
+                title: i18n.tr("Write image")
+                text: i18n.tr("This action will wipe the content from the device")
+            }
+        },
+        State {
+            name: "writing"
+            when: d.confirmed && driveCtrl.writing
+            PropertyChanges {
+                target: writeImageDlg
+                explicit: true
+                title: driveCtrl.writeVerifying ? i18n.tr("Verifying") : i18n.tr("Writing")
+                text: ""
+            }
+            PropertyChanges {
+                target: imageField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: writeProgress
+                explicit: true
+                visible: true
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "done"
+            when: d.confirmed && !driveCtrl.writing && !driveCtrl.writeError
+            PropertyChanges {
+                target: writeImageDlg
+                explicit: true
+                title: i18n.tr("Image Written")
+                text: i18n.tr("The image was written and verified")
+            }
+            PropertyChanges {
+                target: imageField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                text: i18n.tr("Ok")
+                color: theme.palette.normal.positive
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        },
+        State {
+            name: "error"
+            when: d.confirmed && !driveCtrl.writing && driveCtrl.writeError
+            PropertyChanges {
+                target: writeImageDlg
+                explicit: true
+                title: i18n.tr("Write Error")
+                text: i18n.tr("The image could not be written to the device")
+            }
+            PropertyChanges {
+                target: imageField
+                explicit: true
+                visible: false
+            }
+            PropertyChanges {
+                target: okButton
+                explicit: true
+                text: i18n.tr("Ok")
+                color: theme.palette.normal.overlaySecondaryText
+            }
+            PropertyChanges {
+                target: cancelButton
+                explicit: true
+                visible: false
+            }
+        }
+    ]
+
+    QtObject {
+        id: d
+        property bool confirmed: false
+    }
+}
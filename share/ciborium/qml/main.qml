@@ -36,6 +36,26 @@ MainView {
                     console.log("Format button clicked")
                     PopupUtils.open(Qt.resolvedUrl("./components/FormatDialog.qml", mainPage, {"driveIndex": index}))
                 }
+                onUnlockClicked: {
+                    console.log("Unlock button clicked")
+                    PopupUtils.open(Qt.resolvedUrl("./components/UnlockDialog.qml", mainPage, {"driveIndex": index}))
+                }
+                onCheckClicked: {
+                    console.log("Check button clicked")
+                    PopupUtils.open(Qt.resolvedUrl("./components/CheckDialog.qml", mainPage, {"driveIndex": index}))
+                }
+                onRenameClicked: {
+                    console.log("Rename button clicked")
+                    PopupUtils.open(Qt.resolvedUrl("./components/RenameDialog.qml", mainPage, {"driveIndex": index}))
+                }
+                onBackupClicked: {
+                    console.log("Back up button clicked")
+                    PopupUtils.open(Qt.resolvedUrl("./components/BackupDialog.qml", mainPage, {"driveIndex": index}))
+                }
+                onWriteImageClicked: {
+                    console.log("Write image button clicked")
+                    PopupUtils.open(Qt.resolvedUrl("./components/WriteImageDialog.qml", mainPage, {"driveIndex": index}))
+                }
                 onSafeRemovalClicked: {
                     console.log("Safe removal button clicked")
                     PopupUtils.open(Qt.resolvedUrl("./components/SafeRemoval.qml", mainPage, {"driveIndex": index}))
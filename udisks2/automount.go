@@ -0,0 +1,172 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+// AutomountAction tells what is done with a filesystem that can be automounted.
+type AutomountAction string
+
+const (
+	// AutomountMount mounts the filesystem.
+	AutomountMount AutomountAction = "mount"
+	// AutomountReadOnly mounts the filesystem read only.
+	AutomountReadOnly AutomountAction = "mount-ro"
+	// AutomountIgnore leaves the filesystem unmounted.
+	AutomountIgnore AutomountAction = "ignore"
+	// AutomountNotify leaves the filesystem unmounted and sends a blocked event.
+	AutomountNotify AutomountAction = "notify"
+)
+
+// valid tells if the action is one of the actions above.
+func (a AutomountAction) valid() bool {
+	switch a {
+	case AutomountMount, AutomountReadOnly, AutomountIgnore, AutomountNotify:
+		return true
+	}
+	return false
+}
+
+// AutomountRule matches block devices by the properties of their filesystem and drive.
+// Empty fields match any value, Vendor and Model are shell patterns.
+type AutomountRule struct {
+	UUID          string          `json:"uuid"`
+	Serial        string          `json:"serial"`
+	Vendor        string          `json:"vendor"`
+	Model         string          `json:"model"`
+	ConnectionBus string          `json:"connection-bus"`
+	Filesystem    string          `json:"filesystem"`
+	Action        AutomountAction `json:"action"`
+}
+
+// AutomountRules decides what is done with the filesystems that can be automounted, the
+// action of the first matching rule is taken and Default is used when no rule matches.
+type AutomountRules struct {
+	Default AutomountAction `json:"default"`
+	Rules   []AutomountRule `json:"rules"`
+}
+
+// DefaultAutomountRules mount every filesystem.
+var DefaultAutomountRules = AutomountRules{Default: AutomountMount}
+
+// Validate returns an error if the default or the action of a rule is not a known
+// action. An empty default mounts every filesystem.
+func (r AutomountRules) Validate() error {
+	if r.Default != "" && !r.Default.valid() {
+		return fmt.Errorf("unknown automount default %q", r.Default)
+	}
+	for i, rule := range r.Rules {
+		if !rule.Action.valid() {
+			return fmt.Errorf("unknown action %q in automount rule %d", rule.Action, i+1)
+		}
+	}
+	return nil
+}
+
+func (r AutomountRule) matches(block *BlockInfo, drive DriveInfo) bool {
+	if r.UUID != "" && !strings.EqualFold(r.UUID, block.IdUUID) {
+		return false
+	}
+	if r.Serial != "" && !strings.EqualFold(r.Serial, drive.Serial) {
+		return false
+	}
+	if r.Filesystem != "" && r.Filesystem != block.IdType {
+		return false
+	}
+	if r.ConnectionBus != "" && r.ConnectionBus != drive.ConnectionBus {
+		return false
+	}
+	if r.Vendor != "" && !globMatch(r.Vendor, drive.Vendor) {
+		return false
+	}
+	if r.Model != "" && !globMatch(r.Model, drive.Model) {
+		return false
+	}
+	return true
+}
+
+func globMatch(pattern, value string) bool {
+	matched, err := path.Match(pattern, strings.TrimSpace(value))
+	if err != nil {
+		log.Println("Invalid pattern", pattern, "in automount rule:", err)
+		return false
+	}
+	return matched
+}
+
+// action returns the action for the block device held by the drive, filesystems are
+// ignored when the action is not known.
+func (r AutomountRules) action(block *BlockInfo, drive DriveInfo) AutomountAction {
+	action := r.Default
+	if action == "" {
+		action = AutomountMount
+	}
+	for _, rule := range r.Rules {
+		if rule.matches(block, drive) {
+			action = rule.Action
+			break
+		}
+	}
+	if !action.valid() {
+		log.Println("Unknown automount action", action)
+		return AutomountIgnore
+	}
+	return action
+}
+
+// SetAutomountRules replaces the rules used to decide what is done with the filesystems
+// that are added from now on.
+func (u *UDisks2) SetAutomountRules(r AutomountRules) {
+	u.mapLock.Lock()
+	defer u.mapLock.Unlock()
+	u.automountRules = r
+}
+
+// SubscribeBlockedEvents returns a channel where the filesystems that are not mounted
+// because of an AutomountNotify rule are sent.
+func (u *UDisks2) SubscribeBlockedEvents(opts ...SubscribeOptions) <-chan *Event {
+	o := subscribeOptions(opts)
+	blocked := make(chan *Event, o.Buffer)
+	u.bus.subscribe(topicBlockBlocked, blocked, o)
+	return blocked
+}
+
+// automountAction returns the action for the block device, mapLock has to be held.
+func (u *UDisks2) automountAction(p dbus.ObjectPath, props InterfacesAndProperties) AutomountAction {
+	block, err := props.BlockInfo()
+	if err != nil {
+		return AutomountIgnore
+	}
+	var drive DriveInfo
+	for _, d := range u.drives {
+		if _, ok := d.blockDevices[p]; ok {
+			drive = d.Info()
+			break
+		}
+	}
+	return u.automountRules.action(block, drive)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	. "launchpad.net/gocheck"
+)
+
+type AutomountTestSuite struct {
+	rules AutomountRules
+	block *BlockInfo
+	drive DriveInfo
+}
+
+var _ = Suite(&AutomountTestSuite{})
+
+func (s *AutomountTestSuite) SetUpTest(c *C) {
+	s.rules = AutomountRules{
+		Default: AutomountNotify,
+		Rules: []AutomountRule{
+			{UUID: "1234-abcd", Action: AutomountMount},
+			{Vendor: "Kingston*", ConnectionBus: "usb", Action: AutomountReadOnly},
+			{Filesystem: FilesystemNtfs, Action: AutomountIgnore},
+		},
+	}
+	s.block = &BlockInfo{IdType: FilesystemVfat, IdUUID: "5678-EF01"}
+	s.drive = DriveInfo{Vendor: "Generic", Model: "SD Reader", ConnectionBus: "usb"}
+}
+
+func (s *AutomountTestSuite) TestDefault(c *C) {
+	c.Assert(s.rules.action(s.block, s.drive), Equals, AutomountNotify)
+}
+
+func (s *AutomountTestSuite) TestEmptyRules(c *C) {
+	c.Assert(AutomountRules{}.action(s.block, s.drive), Equals, AutomountMount)
+}
+
+func (s *AutomountTestSuite) TestUUIDIgnoresCase(c *C) {
+	s.block.IdUUID = "1234-ABCD"
+	c.Assert(s.rules.action(s.block, s.drive), Equals, AutomountMount)
+}
+
+func (s *AutomountTestSuite) TestVendorGlobAndBus(c *C) {
+	s.drive.Vendor = "Kingston "
+	c.Assert(s.rules.action(s.block, s.drive), Equals, AutomountReadOnly)
+	s.drive.ConnectionBus = "sdio"
+	c.Assert(s.rules.action(s.block, s.drive), Equals, AutomountNotify)
+}
+
+func (s *AutomountTestSuite) TestFirstMatchWins(c *C) {
+	s.block.IdUUID = "1234-ABCD"
+	s.block.IdType = FilesystemNtfs
+	c.Assert(s.rules.action(s.block, s.drive), Equals, AutomountMount)
+	s.block.IdUUID = ""
+	c.Assert(s.rules.action(s.block, s.drive), Equals, AutomountIgnore)
+}
+
+func (s *AutomountTestSuite) TestReadOnlyOptions(c *C) {
+	c.Assert(readOnlyOptions("rw,noexec,flush"), Equals, "ro,noexec,flush")
+	c.Assert(readOnlyOptions(""), Equals, "ro")
+}
+
+func (s *AutomountTestSuite) TestUnknownActionIgnores(c *C) {
+	s.rules.Rules[0].Action = "deny"
+	s.block.IdUUID = "1234-abcd"
+	c.Assert(s.rules.action(s.block, s.drive), Equals, AutomountIgnore)
+
+	s.rules.Default = "block"
+	s.block.IdUUID = "5678-EF01"
+	c.Assert(s.rules.action(s.block, s.drive), Equals, AutomountIgnore)
+}
+
+func (s *AutomountTestSuite) TestValidate(c *C) {
+	c.Assert(s.rules.Validate(), IsNil)
+	c.Assert(AutomountRules{}.Validate(), IsNil)
+
+	s.rules.Rules[1].Action = "deny"
+	c.Assert(s.rules.Validate(), ErrorMatches, `unknown action "deny" in automount rule 2`)
+
+	c.Assert(AutomountRules{Default: "block"}.Validate(), ErrorMatches, `unknown automount default "block"`)
+}
@@ -0,0 +1,277 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+var (
+	ErrNoBackup         = errors.New("no ongoing backup")
+	ErrIncompleteBackup = errors.New("the drive ended before all of it was backed up")
+)
+
+// BackupEvent is emitted once a drive is backed up.
+type BackupEvent struct {
+	Drive dbus.ObjectPath
+	Image string
+	// SHA256 is the hex encoded hash of the image file, it is also stored next to the
+	// image in a file with the .sha256 extension.
+	SHA256 string
+}
+
+// SubscribeBackupEvents returns a channel where an event is sent once a drive is backed
+// up and a channel for the errors.
+func (u *UDisks2) SubscribeBackupEvents(opts ...SubscribeOptions) (<-chan BackupEvent, <-chan error) {
+	o := subscribeOptions(opts)
+	backupCompleted := make(chan BackupEvent, o.Buffer)
+	backupErrors := make(chan error, o.Buffer)
+	u.bus.subscribe(topicBackupCompleted, backupCompleted, o)
+	u.bus.subscribe(topicBackupErrors, backupErrors, o)
+	return backupCompleted, backupErrors
+}
+
+// SubscribeBackupProgress returns a channel where the progress of the backups is sent.
+func (u *UDisks2) SubscribeBackupProgress(opts ...SubscribeOptions) <-chan ImageProgress {
+	o := subscribeOptions(opts)
+	backupProgress := make(chan ImageProgress, o.Buffer)
+	u.bus.subscribe(topicBackupProgress, backupProgress, o)
+	return backupProgress
+}
+
+// Backup copies the whole drive to the image file, compressed with gzip or xz when its
+// name ends in .gz or .xz. The result is reported with the backup events, ErrCancelled
+// is sent when the backup is stopped with CancelBackup.
+func (u *UDisks2) Backup(d *Drive, image string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	u.backupLock.Lock()
+	u.backups[d.Path] = cancel
+	u.backupLock.Unlock()
+
+	go func() {
+		defer func() {
+			u.backupLock.Lock()
+			delete(u.backups, d.Path)
+			u.backupLock.Unlock()
+			cancel()
+		}()
+		e, err := u.BackupSync(ctx, d, image)
+		if err == context.Canceled {
+			err = ErrCancelled
+		}
+		if err != nil {
+			u.bus.publish(topicBackupErrors, err)
+			return
+		}
+		u.bus.publish(topicBackupCompleted, e)
+	}()
+}
+
+// CancelBackup stops the ongoing backup of the drive, the partial image is removed.
+func (u *UDisks2) CancelBackup(d *Drive) error {
+	u.backupLock.Lock()
+	defer u.backupLock.Unlock()
+	cancel, ok := u.backups[d.Path]
+	if !ok {
+		return ErrNoBackup
+	}
+	log.Println("Cancelling the backup of", d.Path)
+	cancel()
+	return nil
+}
+
+// BackupSync copies the whole drive to the image file and returns once it is done or
+// the context is done, in which case the partial image is removed. The filesystems of
+// the drive are unmounted during the backup. Encrypted containers are locked for the
+// backup and left locked, unlocking them again needs their passphrase.
+func (u *UDisks2) BackupSync(ctx context.Context, d *Drive, image string) (BackupEvent, error) {
+	log.Println("Backing up", d.Path, "to", image)
+	blockPath, err := wholeBlock(d)
+	if err != nil {
+		return BackupEvent{}, err
+	}
+	info, err := d.blockDevices[blockPath].BlockInfo()
+	if err != nil {
+		return BackupEvent{}, err
+	}
+
+	// the device is opened exclusively, which fails while its filesystems are in use
+	var mounted []dbus.ObjectPath
+	for p, block := range d.blockDevices {
+		if blockInfo, err := block.BlockInfo(); err == nil && blockInfo.CryptoBackingDevice != "" && blockInfo.CryptoBackingDevice != "/" {
+			// cleartext devices are gone once locked
+			continue
+		}
+		if len(u.mountpointsForPath(p)) > 0 {
+			mounted = append(mounted, p)
+		}
+	}
+	if err := u.unmountAll(d, DefaultUnmountMode); err != nil {
+		return BackupEvent{}, err
+	}
+	defer func() {
+		for _, p := range mounted {
+			if _, err := u.syncMount(p); err != nil {
+				log.Println("Cannot mount", p, "again after the backup:", err)
+			}
+		}
+	}()
+	if err := u.lockAll(d); err != nil {
+		return BackupEvent{}, err
+	}
+
+	dev, err := u.openBlock(blockPath, "OpenForBackup")
+	if err != nil {
+		return BackupEvent{}, err
+	}
+	defer dev.Close()
+
+	progress := u.imageProgress(topicBackupProgress, d.Path, false)
+	sum, err := writeBackup(ctx, dev, info.Size, image, progress)
+	if err != nil {
+		log.Println("Backup of", d.Path, "failed:", err)
+		return BackupEvent{}, err
+	}
+	return BackupEvent{d.Path, image, sum}, nil
+}
+
+// writeBackup copies size bytes of the device to the image and its .sha256 sidecar and
+// returns the hash of the image. The partial image is removed on errors.
+func writeBackup(ctx context.Context, dev io.Reader, size uint64, image string, progress func(float64)) (string, error) {
+	partial := image + ".part"
+	sink, err := createImage(partial)
+	if err != nil {
+		return "", err
+	}
+	copied, err := copyChunks(ctx, sink, io.LimitReader(dev, int64(size)), func(n int64) {
+		if size > 0 {
+			progress(float64(n) / float64(size) * 100)
+		}
+	})
+	if closeErr := sink.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && copied != int64(size) {
+		log.Println("Backed up", copied, "bytes out of", size)
+		err = ErrIncompleteBackup
+	}
+	if err == nil {
+		err = os.Rename(partial, image)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+
+	// the sidecar uses the format of sha256sum so that the image can be checked with it
+	sum := sink.sum()
+	sidecar := fmt.Sprintf("%s  %s\n", sum, filepath.Base(image))
+	if err := ioutil.WriteFile(image+".sha256", []byte(sidecar), 0644); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// imageSink writes an image file, compressing it when needed, and hashes the file.
+type imageSink struct {
+	file *os.File
+	hash hash.Hash
+	w    io.WriteCloser
+	cmd  *exec.Cmd
+}
+
+// createImage creates the image file, images ending in .gz or .xz are compressed. The
+// extension is looked up without the .part suffix of partial images.
+func createImage(image string) (*imageSink, error) {
+	file, err := os.Create(image)
+	if err != nil {
+		return nil, err
+	}
+	s := &imageSink{file: file, hash: sha256.New()}
+	out := io.MultiWriter(file, s.hash)
+	switch name := strings.TrimSuffix(strings.ToLower(image), ".part"); {
+	case strings.HasSuffix(name, ".gz"):
+		s.w = gzip.NewWriter(out)
+	case strings.HasSuffix(name, ".xz"):
+		// there is no xz encoder in the standard library
+		s.cmd = exec.Command("xz", "--compress", "--stdout")
+		s.cmd.Stdout = out
+		if s.w, err = s.cmd.StdinPipe(); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err := s.cmd.Start(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	default:
+		s.w = nopWriteCloser{out}
+	}
+	return s, nil
+}
+
+func (s *imageSink) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// Close flushes the compressed data and closes the file once it is on disk.
+func (s *imageSink) Close() error {
+	err := s.w.Close()
+	if s.cmd != nil {
+		if waitErr := s.cmd.Wait(); err == nil {
+			err = waitErr
+		}
+	}
+	if syncErr := s.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// sum returns the hex encoded hash of the file, it is only complete once closed.
+func (s *imageSink) sum() string {
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"launchpad.net/go-dbus/v1"
+	. "launchpad.net/gocheck"
+)
+
+type BackupTestSuite struct {
+	content []byte
+}
+
+var _ = Suite(&BackupTestSuite{})
+
+func (s *BackupTestSuite) SetUpSuite(c *C) {
+	s.content = bytes.Repeat([]byte("DCIM"), imageChunkSize/2)
+}
+
+// roundTrip writes the content to the image and reads it back.
+func (s *BackupTestSuite) roundTrip(c *C, image string) {
+	sink, err := createImage(image + ".part")
+	c.Assert(err, IsNil)
+	_, err = copyChunks(context.Background(), sink, bytes.NewReader(s.content), func(int64) {})
+	c.Assert(err, IsNil)
+	c.Assert(sink.Close(), IsNil)
+
+	written, err := ioutil.ReadFile(image + ".part")
+	c.Assert(err, IsNil)
+	sum := sha256.Sum256(written)
+	c.Assert(sink.sum(), Equals, hex.EncodeToString(sum[:]))
+
+	c.Assert(os.Rename(image+".part", image), IsNil)
+	src, err := openImage(image)
+	c.Assert(err, IsNil)
+	defer src.Close()
+	var out bytes.Buffer
+	_, err = copyChunks(context.Background(), &out, src, func(int64) {})
+	c.Assert(err, IsNil)
+	c.Assert(bytes.Equal(out.Bytes(), s.content), Equals, true)
+}
+
+func (s *BackupTestSuite) TestRawImage(c *C) {
+	s.roundTrip(c, filepath.Join(c.MkDir(), "camera.img"))
+}
+
+func (s *BackupTestSuite) TestGzipImage(c *C) {
+	image := filepath.Join(c.MkDir(), "camera.img.gz")
+	s.roundTrip(c, image)
+	compressed, err := ioutil.ReadFile(image)
+	c.Assert(err, IsNil)
+	c.Assert(len(compressed) < len(s.content), Equals, true)
+}
+
+func (s *BackupTestSuite) TestXzImage(c *C) {
+	if _, err := exec.LookPath("xz"); err != nil {
+		c.Skip("xz is not installed")
+	}
+	s.roundTrip(c, filepath.Join(c.MkDir(), "camera.img.xz"))
+}
+
+func (s *BackupTestSuite) TestCancelBackupNotRunning(c *C) {
+	u := &UDisks2{backups: make(map[dbus.ObjectPath]context.CancelFunc)}
+	c.Assert(u.CancelBackup(&Drive{Path: testDrivePath}), Equals, ErrNoBackup)
+}
+
+func (s *BackupTestSuite) TestWriteBackup(c *C) {
+	image := filepath.Join(c.MkDir(), "camera.img")
+	var last float64
+	sum, err := writeBackup(context.Background(), bytes.NewReader(s.content), uint64(len(s.content)), image, func(p float64) { last = p })
+	c.Assert(err, IsNil)
+	c.Assert(last, Equals, float64(100))
+
+	written, err := ioutil.ReadFile(image)
+	c.Assert(err, IsNil)
+	c.Assert(bytes.Equal(written, s.content), Equals, true)
+	sidecar, err := ioutil.ReadFile(image + ".sha256")
+	c.Assert(err, IsNil)
+	c.Assert(string(sidecar), Equals, sum+"  camera.img\n")
+}
+
+func (s *BackupTestSuite) TestWriteBackupShortRead(c *C) {
+	dir := c.MkDir()
+	image := filepath.Join(dir, "camera.img")
+	_, err := writeBackup(context.Background(), bytes.NewReader(s.content), uint64(len(s.content)+1), image, func(float64) {})
+	c.Assert(err, Equals, ErrIncompleteBackup)
+
+	// neither the image nor its sidecar are left behind
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+}
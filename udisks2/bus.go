@@ -0,0 +1,230 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"log"
+	"reflect"
+	"sync"
+)
+
+// DeliveryPolicy tells what is done with an event when the buffer of a subscriber is full.
+type DeliveryPolicy int
+
+const (
+	// Block waits until the subscriber reads the event, slowing down the delivery of
+	// the events to the rest of the subscribers.
+	Block DeliveryPolicy = iota
+	// DropNewest discards the event that does not fit in the buffer.
+	DropNewest
+	// DropOldest discards the oldest buffered event to make room for the new one.
+	DropOldest
+)
+
+// SubscribeOptions configures the channels returned by the Subscribe methods.
+type SubscribeOptions struct {
+	// Buffer is the amount of events that are queued for the subscriber.
+	Buffer int
+	// Policy is applied when the buffer is full.
+	Policy DeliveryPolicy
+}
+
+// DefaultSubscribeOptions are used when no options are given to a Subscribe method. A
+// subscriber that stops reading loses its oldest events instead of stalling the event
+// loop, subscribers that cannot lose events have to ask for Block.
+var DefaultSubscribeOptions = SubscribeOptions{Buffer: 16, Policy: DropOldest}
+
+type topic int
+
+const (
+	topicBlockAdded topic = iota
+	topicBlockError
+	topicMountRemoved
+	topicBlockDevice
+	topicFormatCompleted
+	topicFormatErrors
+	topicUnmountCompleted
+	topicUnmountErrors
+	topicMountCompleted
+	topicMountErrors
+	topicJobProgress
+	topicDriveChanged
+	topicReadyToRemove
+	topicPowerOffErrors
+	topicUnlockRequired
+	topicCheckCompleted
+	topicCheckErrors
+	topicBlockBlocked
+	topicImageProgress
+	topicImageCompleted
+	topicImageErrors
+	topicBackupProgress
+	topicBackupCompleted
+	topicBackupErrors
+	topicDetached
+)
+
+// publication is an event to be published once the locks held to create it are released.
+type publication struct {
+	topic topic
+	value interface{}
+}
+
+type subscriber struct {
+	topic   topic
+	ch      reflect.Value
+	policy  DeliveryPolicy
+	lock    sync.Mutex
+	done    chan struct{}
+	closed  bool
+	dropped uint64
+}
+
+// deliver sends the value to the subscriber following its delivery policy. A blocked
+// delivery is interrupted when the subscriber is removed.
+func (s *subscriber) deliver(v interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+
+	value := reflect.ValueOf(v)
+	if !value.IsValid() {
+		value = reflect.Zero(s.ch.Type().Elem())
+	}
+
+	switch {
+	case s.policy == DropOldest && s.ch.Cap() > 0:
+		for !s.ch.TrySend(value) {
+			s.ch.TryRecv()
+			s.dropped++
+		}
+	case s.policy == DropOldest || s.policy == DropNewest:
+		if !s.ch.TrySend(value) {
+			s.dropped++
+		}
+	default:
+		reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: s.ch, Send: value},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.done)},
+		})
+	}
+	if s.dropped > 0 && s.dropped%100 == 1 {
+		log.Println("Slow subscriber for topic", s.topic, "has dropped", s.dropped, "events")
+	}
+}
+
+func (s *subscriber) close() {
+	close(s.done)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	s.ch.Close()
+}
+
+// eventBus fans out the events of each topic to all of its subscribers.
+type eventBus struct {
+	lock        sync.Mutex
+	subscribers []*subscriber
+	closed      bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{}
+}
+
+// subscribe registers ch, which must be a channel, to receive the events of the topic.
+func (b *eventBus) subscribe(t topic, ch interface{}, opts SubscribeOptions) {
+	s := &subscriber{
+		topic:  t,
+		ch:     reflect.ValueOf(ch),
+		policy: opts.Policy,
+		done:   make(chan struct{}),
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		s.close()
+		return
+	}
+	b.subscribers = append(b.subscribers, s)
+}
+
+// unsubscribe removes and closes the channel, which has to be one of the channels returned
+// by a Subscribe method.
+func (b *eventBus) unsubscribe(ch interface{}) bool {
+	pointer := reflect.ValueOf(ch).Pointer()
+	b.lock.Lock()
+	var found *subscriber
+	for i, s := range b.subscribers {
+		if s.ch.Pointer() == pointer {
+			found = s
+			b.subscribers = append(b.subscribers[:i], b.subscribers[i+1:]...)
+			break
+		}
+	}
+	b.lock.Unlock()
+
+	if found == nil {
+		return false
+	}
+	found.close()
+	return true
+}
+
+// close removes and closes all the subscribers, later subscriptions get a closed channel.
+func (b *eventBus) close() {
+	b.lock.Lock()
+	subscribers := b.subscribers
+	b.subscribers = nil
+	b.closed = true
+	b.lock.Unlock()
+
+	for _, s := range subscribers {
+		s.close()
+	}
+}
+
+// publish delivers the value to every subscriber of the topic.
+func (b *eventBus) publish(t topic, v interface{}) {
+	for _, s := range b.subscribersFor(t) {
+		s.deliver(v)
+	}
+}
+
+func (b *eventBus) subscribersFor(t topic) []*subscriber {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var subscribers []*subscriber
+	for _, s := range b.subscribers {
+		if s.topic == t {
+			subscribers = append(subscribers, s)
+		}
+	}
+	return subscribers
+}
+
+func subscribeOptions(opts []SubscribeOptions) SubscribeOptions {
+	if len(opts) == 0 {
+		return DefaultSubscribeOptions
+	}
+	return opts[0]
+}
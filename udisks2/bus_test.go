@@ -0,0 +1,151 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	. "launchpad.net/gocheck"
+)
+
+type EventBusTestSuite struct {
+	bus *eventBus
+}
+
+var _ = Suite(&EventBusTestSuite{})
+
+func (s *EventBusTestSuite) SetUpTest(c *C) {
+	s.bus = newEventBus()
+}
+
+func (s *EventBusTestSuite) TestPublishNoSubscribers(c *C) {
+	// nothing should block
+	s.bus.publish(topicMountRemoved, "/media/card")
+}
+
+func (s *EventBusTestSuite) TestPublishSeveralSubscribers(c *C) {
+	first := make(chan string, 1)
+	second := make(chan string, 1)
+	other := make(chan string, 1)
+	s.bus.subscribe(topicMountRemoved, first, DefaultSubscribeOptions)
+	s.bus.subscribe(topicMountRemoved, second, DefaultSubscribeOptions)
+	s.bus.subscribe(topicUnmountCompleted, other, DefaultSubscribeOptions)
+
+	s.bus.publish(topicMountRemoved, "/media/card")
+	c.Assert(<-first, Equals, "/media/card")
+	c.Assert(<-second, Equals, "/media/card")
+	c.Assert(len(other), Equals, 0)
+}
+
+func (s *EventBusTestSuite) TestPublishError(c *C) {
+	errs := make(chan error, 1)
+	s.bus.subscribe(topicFormatErrors, errs, DefaultSubscribeOptions)
+
+	s.bus.publish(topicFormatErrors, ErrCancelled)
+	c.Assert(<-errs, Equals, ErrCancelled)
+}
+
+func (s *EventBusTestSuite) TestDropNewest(c *C) {
+	ch := make(chan bool, 1)
+	s.bus.subscribe(topicBlockDevice, ch, SubscribeOptions{1, DropNewest})
+
+	s.bus.publish(topicBlockDevice, true)
+	s.bus.publish(topicBlockDevice, false)
+	c.Assert(<-ch, Equals, true)
+	c.Assert(len(ch), Equals, 0)
+}
+
+func (s *EventBusTestSuite) TestDropOldest(c *C) {
+	ch := make(chan bool, 1)
+	s.bus.subscribe(topicBlockDevice, ch, SubscribeOptions{1, DropOldest})
+
+	s.bus.publish(topicBlockDevice, true)
+	s.bus.publish(topicBlockDevice, false)
+	c.Assert(<-ch, Equals, false)
+	c.Assert(len(ch), Equals, 0)
+}
+
+func (s *EventBusTestSuite) TestDropUnbuffered(c *C) {
+	ch := make(chan bool)
+	s.bus.subscribe(topicBlockDevice, ch, SubscribeOptions{0, DropOldest})
+
+	// nobody is reading so the event is dropped
+	s.bus.publish(topicBlockDevice, true)
+}
+
+func (s *EventBusTestSuite) TestUnsubscribe(c *C) {
+	ch := make(chan error, 1)
+	s.bus.subscribe(topicMountErrors, ch, DefaultSubscribeOptions)
+
+	c.Assert(s.bus.unsubscribe(ch), Equals, true)
+	s.bus.publish(topicMountErrors, errors.New("not delivered"))
+	_, ok := <-ch
+	c.Assert(ok, Equals, false)
+	c.Assert(s.bus.unsubscribe(ch), Equals, false)
+}
+
+func (s *EventBusTestSuite) TestDefaultDoesNotBlock(c *C) {
+	ch := make(chan string, DefaultSubscribeOptions.Buffer)
+	s.bus.subscribe(topicMountRemoved, ch, DefaultSubscribeOptions)
+
+	// nobody is reading so the oldest events are dropped
+	for i := 0; i <= DefaultSubscribeOptions.Buffer; i++ {
+		s.bus.publish(topicMountRemoved, fmt.Sprintf("/media/card%d", i))
+	}
+	c.Assert(len(ch), Equals, DefaultSubscribeOptions.Buffer)
+	c.Assert(<-ch, Equals, "/media/card1")
+}
+
+func (s *EventBusTestSuite) TestUnsubscribeBlockedPublish(c *C) {
+	ch := make(chan string)
+	s.bus.subscribe(topicMountRemoved, ch, SubscribeOptions{0, Block})
+
+	published := make(chan bool)
+	go func() {
+		s.bus.publish(topicMountRemoved, "/media/card")
+		published <- true
+	}()
+
+	// the publisher is blocked until the subscriber goes away
+	time.Sleep(10 * time.Millisecond)
+	s.bus.unsubscribe(ch)
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		c.Fatal("publish was not interrupted")
+	}
+}
+
+func (s *EventBusTestSuite) TestClose(c *C) {
+	ch := make(chan string)
+	s.bus.subscribe(topicMountRemoved, ch, DefaultSubscribeOptions)
+
+	s.bus.close()
+	_, ok := <-ch
+	c.Assert(ok, Equals, false)
+
+	// subscribing after the bus is closed returns a closed channel
+	late := make(chan string)
+	s.bus.subscribe(topicMountRemoved, late, DefaultSubscribeOptions)
+	_, ok = <-late
+	c.Assert(ok, Equals, false)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+// procDir is where the processes are looked up, it is changed by the tests.
+var procDir = "/proc"
+
+// Process is a process that holds files from a mounted filesystem.
+type Process struct {
+	PID     int
+	Command string
+	// AppID is the application id of click and snap applications, empty otherwise.
+	AppID string
+}
+
+// Name returns the name of the application for application processes or the command
+// for any other process.
+func (p Process) Name() string {
+	if p.AppID == "" {
+		return p.Command
+	}
+	// click application ids are package_app_version
+	if parts := strings.Split(p.AppID, "_"); len(parts) == 3 {
+		return strings.Title(parts[1])
+	}
+	return strings.Title(p.AppID[strings.LastIndex(p.AppID, ".")+1:])
+}
+
+// BusyError is returned when a filesystem cannot be unmounted because it is in use.
+type BusyError struct {
+	Mountpoint string
+	Processes  []Process
+}
+
+func (e *BusyError) Error() string {
+	names := make([]string, len(e.Processes))
+	for i, p := range e.Processes {
+		names[i] = fmt.Sprintf("%s (%d)", p.Command, p.PID)
+	}
+	return fmt.Sprintf("%s: %s is used by %s", ErrBusy, e.Mountpoint, strings.Join(names, ", "))
+}
+
+// IsBusy returns true if the error is ErrBusy or a BusyError.
+func IsBusy(err error) bool {
+	_, ok := err.(*BusyError)
+	return ok || err == ErrBusy
+}
+
+// busyError returns a BusyError with the processes using the filesystem of the block
+// device, ErrBusy is returned if they cannot be found.
+func (u *UDisks2) busyError(o dbus.ObjectPath) error {
+	d, ok := u.BlockDrive(o)
+	if !ok {
+		return ErrBusy
+	}
+	fs, err := d.blockDevices[o].FilesystemInfo()
+	if err != nil || len(fs.MountPoints) == 0 {
+		return ErrBusy
+	}
+	for _, mountpoint := range fs.MountPoints {
+		processes := processesUsing(mountpoint)
+		if len(processes) > 0 {
+			return &BusyError{Mountpoint: mountpoint, Processes: processes}
+		}
+	}
+	return ErrBusy
+}
+
+// processesUsing returns the processes with open files, working directory or mapped
+// files under the mountpoint.
+func processesUsing(mountpoint string) []Process {
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		log.Println("Cannot list the processes:", err)
+		return nil
+	}
+	var processes []Process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(procDir, entry.Name())
+		if !usesMountpoint(dir, mountpoint) {
+			continue
+		}
+		processes = append(processes, Process{
+			PID:     pid,
+			Command: readComm(dir),
+			AppID:   readAppID(dir),
+		})
+	}
+	return processes
+}
+
+func usesMountpoint(dir, mountpoint string) bool {
+	for _, link := range []string{"cwd", "root", "exe"} {
+		if target, err := os.Readlink(filepath.Join(dir, link)); err == nil && isUnder(target, mountpoint) {
+			return true
+		}
+	}
+	// processes of other users cannot be inspected and are skipped
+	fds, _ := ioutil.ReadDir(filepath.Join(dir, "fd"))
+	for _, fd := range fds {
+		if target, err := os.Readlink(filepath.Join(dir, "fd", fd.Name())); err == nil && isUnder(target, mountpoint) {
+			return true
+		}
+	}
+	maps, err := os.Open(filepath.Join(dir, "maps"))
+	if err != nil {
+		return false
+	}
+	defer maps.Close()
+	scanner := bufio.NewScanner(maps)
+	for scanner.Scan() {
+		// the path is the sixth field and may contain spaces
+		fields := strings.SplitN(scanner.Text(), " ", 6)
+		if len(fields) == 6 && isUnder(strings.TrimSpace(fields[5]), mountpoint) {
+			return true
+		}
+	}
+	return false
+}
+
+func isUnder(p, mountpoint string) bool {
+	return p == mountpoint || strings.HasPrefix(p, strings.TrimSuffix(mountpoint, "/")+"/")
+}
+
+func readComm(dir string) string {
+	comm, err := ioutil.ReadFile(filepath.Join(dir, "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+func readAppID(dir string) string {
+	environ, err := ioutil.ReadFile(filepath.Join(dir, "environ"))
+	if err != nil {
+		return ""
+	}
+	for _, v := range bytes.Split(environ, []byte{0}) {
+		if bytes.HasPrefix(v, []byte("APP_ID=")) {
+			return string(v[len("APP_ID="):])
+		}
+	}
+	return ""
+}
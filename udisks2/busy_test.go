@@ -0,0 +1,90 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "launchpad.net/gocheck"
+)
+
+const testMountpoint = "/media/phablet/CAMERA"
+
+type BusyTestSuite struct {
+	oldProcDir string
+}
+
+var _ = Suite(&BusyTestSuite{})
+
+func (s *BusyTestSuite) SetUpTest(c *C) {
+	s.oldProcDir = procDir
+	procDir = c.MkDir()
+}
+
+func (s *BusyTestSuite) TearDownTest(c *C) {
+	procDir = s.oldProcDir
+}
+
+func (s *BusyTestSuite) addProcess(c *C, pid, comm, environ string) string {
+	dir := filepath.Join(procDir, pid)
+	c.Assert(os.MkdirAll(filepath.Join(dir, "fd"), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "environ"), []byte(environ), 0644), IsNil)
+	c.Assert(os.Symlink("/home/phablet", filepath.Join(dir, "cwd")), IsNil)
+	return dir
+}
+
+func (s *BusyTestSuite) TestProcessesUsing(c *C) {
+	music := s.addProcess(c, "1234", "qmlscene", "HOME=/home/phablet\x00APP_ID=com.ubuntu.music_music_2.5.1\x00")
+	c.Assert(os.Symlink(testMountpoint+"/Music/song.ogg", filepath.Join(music, "fd", "12")), IsNil)
+
+	shell := s.addProcess(c, "42", "bash", "")
+	c.Assert(os.Remove(filepath.Join(shell, "cwd")), IsNil)
+	c.Assert(os.Symlink(testMountpoint, filepath.Join(shell, "cwd")), IsNil)
+
+	viewer := s.addProcess(c, "77", "viewer", "")
+	maps := "7f0000000000-7f0000001000 r--p 00000000 b3:11 12 " + testMountpoint + "/Pictures/a photo.jpg\n"
+	c.Assert(ioutil.WriteFile(filepath.Join(viewer, "maps"), []byte(maps), 0644), IsNil)
+
+	other := s.addProcess(c, "99", "other", "")
+	c.Assert(os.Symlink(testMountpoint+"2/file", filepath.Join(other, "fd", "3")), IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(procDir, "self"), 0755), IsNil)
+
+	processes := processesUsing(testMountpoint)
+	c.Assert(processes, DeepEquals, []Process{
+		{PID: 1234, Command: "qmlscene", AppID: "com.ubuntu.music_music_2.5.1"},
+		{PID: 42, Command: "bash"},
+		{PID: 77, Command: "viewer"},
+	})
+}
+
+func (s *BusyTestSuite) TestProcessName(c *C) {
+	c.Assert(Process{Command: "qmlscene", AppID: "com.ubuntu.music_music_2.5.1"}.Name(), Equals, "Music")
+	c.Assert(Process{Command: "gallery", AppID: "org.example.gallery"}.Name(), Equals, "Gallery")
+	c.Assert(Process{Command: "bash"}.Name(), Equals, "bash")
+}
+
+func (s *BusyTestSuite) TestIsBusy(c *C) {
+	c.Assert(IsBusy(ErrBusy), Equals, true)
+	c.Assert(IsBusy(&BusyError{Mountpoint: testMountpoint}), Equals, true)
+	c.Assert(IsBusy(ErrNotMounted), Equals, false)
+}
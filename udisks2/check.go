@@ -0,0 +1,103 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"log"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+// CheckEvent is emitted once a filesystem check or repair is done.
+type CheckEvent struct {
+	Path dbus.ObjectPath
+	// Consistent tells if the filesystem is free of errors, after a repair it is set
+	// when the errors were fixed.
+	Consistent bool
+	// Repaired is set when the event is the result of a repair.
+	Repaired bool
+}
+
+// checkFilesystem runs the Check or Repair of the block device, it is changed by the tests.
+var checkFilesystem = (*UDisks2).syncCheck
+
+// SubscribeCheckEvents returns a channel where the results of Check and Repair are sent
+// and a channel for their errors.
+func (u *UDisks2) SubscribeCheckEvents(opts ...SubscribeOptions) (<-chan CheckEvent, <-chan error) {
+	o := subscribeOptions(opts)
+	checkCompleted := make(chan CheckEvent, o.Buffer)
+	checkErrors := make(chan error, o.Buffer)
+	u.bus.subscribe(topicCheckCompleted, checkCompleted, o)
+	u.bus.subscribe(topicCheckErrors, checkErrors, o)
+	return checkCompleted, checkErrors
+}
+
+// Check verifies the filesystem of the block device. A mounted filesystem is unmounted
+// for the check and mounted again afterwards.
+func (u *UDisks2) Check(p dbus.ObjectPath) {
+	go u.check(p, "Check")
+}
+
+// Repair fixes the errors of the filesystem of the block device. A mounted filesystem is
+// unmounted for the repair and mounted again afterwards.
+func (u *UDisks2) Repair(p dbus.ObjectPath) {
+	go u.check(p, "Repair")
+}
+
+func (u *UDisks2) check(p dbus.ObjectPath, method string) {
+	consistent, err := checkFilesystem(u, p, method)
+	if err != nil {
+		u.bus.publish(topicCheckErrors, err)
+		return
+	}
+	u.bus.publish(topicCheckCompleted, CheckEvent{p, consistent, method == "Repair"})
+}
+
+// syncCheck calls the Check or Repair method of the filesystem and returns its result,
+// the filesystem is remounted if it was mounted.
+func (u *UDisks2) syncCheck(p dbus.ObjectPath, method string) (bool, error) {
+	mounted := len(u.mountpointsForPath(p)) > 0
+	if mounted {
+		if err := u.syncUmount(p, DefaultUnmountMode); err != nil {
+			log.Println("Error while doing a pre-check unmount:", err)
+			return false, err
+		}
+	}
+
+	log.Println("Calling", method, "on", p)
+	var result bool
+	obj := u.conn.Object(dbusName, p)
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	reply, err := call(obj, dbusFilesystemInterface, method, options)
+	if err == nil {
+		err = reply.Args(&result)
+	}
+
+	if mounted {
+		if _, mountErr := u.syncMount(p); mountErr != nil {
+			log.Println("Error while remounting", p, "after", method, ":", mountErr)
+			if err == nil {
+				err = mountErr
+			}
+		}
+	}
+	return result, err
+}
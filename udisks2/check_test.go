@@ -0,0 +1,104 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"errors"
+	"time"
+
+	"launchpad.net/go-dbus/v1"
+	. "launchpad.net/gocheck"
+)
+
+type CheckTestSuite struct {
+	u          *UDisks2
+	completed  <-chan CheckEvent
+	errors     <-chan error
+	methods    []string
+	consistent bool
+	err        error
+}
+
+var _ = Suite(&CheckTestSuite{})
+
+func (s *CheckTestSuite) SetUpTest(c *C) {
+	s.methods = nil
+	s.consistent = false
+	s.err = nil
+	checkFilesystem = func(u *UDisks2, p dbus.ObjectPath, method string) (bool, error) {
+		s.methods = append(s.methods, method)
+		return s.consistent, s.err
+	}
+	s.u = NewStorageWatcher(nil, FilesystemVfat)
+	s.completed, s.errors = s.u.SubscribeCheckEvents()
+}
+
+func (s *CheckTestSuite) TearDownTest(c *C) {
+	checkFilesystem = (*UDisks2).syncCheck
+}
+
+func (s *CheckTestSuite) waitCompleted(c *C) CheckEvent {
+	select {
+	case event := <-s.completed:
+		return event
+	case err := <-s.errors:
+		c.Fatalf("unexpected error %v", err)
+	case <-time.After(time.Second):
+		c.Fatal("no check event")
+	}
+	return CheckEvent{}
+}
+
+func (s *CheckTestSuite) TestCheck(c *C) {
+	s.consistent = true
+	s.u.Check(testBlockPath)
+	c.Assert(s.waitCompleted(c), Equals, CheckEvent{testBlockPath, true, false})
+	c.Assert(s.methods, DeepEquals, []string{"Check"})
+}
+
+func (s *CheckTestSuite) TestCheckInconsistent(c *C) {
+	s.u.Check(testBlockPath)
+	c.Assert(s.waitCompleted(c), Equals, CheckEvent{testBlockPath, false, false})
+}
+
+func (s *CheckTestSuite) TestRepair(c *C) {
+	s.consistent = true
+	s.u.Repair(testBlockPath)
+	c.Assert(s.waitCompleted(c), Equals, CheckEvent{testBlockPath, true, true})
+	c.Assert(s.methods, DeepEquals, []string{"Repair"})
+}
+
+func (s *CheckTestSuite) TestRepairFailed(c *C) {
+	s.u.Repair(testBlockPath)
+	c.Assert(s.waitCompleted(c), Equals, CheckEvent{testBlockPath, false, true})
+}
+
+func (s *CheckTestSuite) TestCheckError(c *C) {
+	s.err = errors.New("filesystem is not supported")
+	s.u.Check(testBlockPath)
+	select {
+	case err := <-s.errors:
+		c.Assert(err, Equals, s.err)
+	case event := <-s.completed:
+		c.Fatalf("unexpected check event %v", event)
+	case <-time.After(time.Second):
+		c.Fatal("no check error")
+	}
+}
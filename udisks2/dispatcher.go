@@ -21,9 +21,9 @@ package udisks2
 
 import (
 	"log"
-	"runtime"
 	"sort"
 	"strings"
+	"sync"
 
 	"launchpad.net/go-dbus/v1"
 )
@@ -49,12 +49,17 @@ func (e *Event) isRemovalEvent() bool {
 }
 
 type dispatcher struct {
-	conn           *dbus.Connection
-	additionsWatch *dbus.SignalWatch
-	removalsWatch  *dbus.SignalWatch
-	Jobs           chan Event
-	Additions      chan Event
-	Removals       chan Event
+	conn            *dbus.Connection
+	additionsWatch  *dbus.SignalWatch
+	removalsWatch   *dbus.SignalWatch
+	propertiesWatch *dbus.SignalWatch
+	Jobs            chan Event
+	JobChanges      chan Event
+	Additions       chan Event
+	Removals        chan Event
+	Changes         chan Event
+	done            chan struct{}
+	wg              sync.WaitGroup
 }
 
 func connectToSignal(conn *dbus.Connection, path dbus.ObjectPath, inter, member string) (*dbus.SignalWatch, error) {
@@ -62,7 +67,7 @@ func connectToSignal(conn *dbus.Connection, path dbus.ObjectPath, inter, member
 	w, err := conn.WatchSignal(&dbus.MatchRule{
 		Type:      dbus.TypeSignal,
 		Sender:    dbusName,
-		Interface: dbusObjectManagerInterface,
+		Interface: inter,
 		Member:    member,
 		Path:      path})
 	return w, err
@@ -79,15 +84,31 @@ func newDispatcher(conn *dbus.Connection) (*dispatcher, error) {
 
 	remove_w, err := connectToSignal(conn, dbusObject, dbusObjectManagerInterface, dbusRemovedSignal)
 	if err != nil {
+		add_w.Cancel()
 		return nil, err
 	}
 
-	jobs_ch := make(chan Event)
-	additions_ch := make(chan Event)
-	remove_ch := make(chan Event)
+	// PropertiesChanged is emitted by each of the objects, therefore the path is not
+	// part of the match rule and the events are filtered by the dispatcher
+	properties_w, err := connectToSignal(conn, "", dbusPropertiesInterface, dbusPropertiesChangedSignal)
+	if err != nil {
+		add_w.Cancel()
+		remove_w.Cancel()
+		return nil, err
+	}
 
-	d := &dispatcher{conn, add_w, remove_w, jobs_ch, additions_ch, remove_ch}
-	runtime.SetFinalizer(d, cleanDispatcherData)
+	d := &dispatcher{
+		conn:            conn,
+		additionsWatch:  add_w,
+		removalsWatch:   remove_w,
+		propertiesWatch: properties_w,
+		Jobs:            make(chan Event),
+		JobChanges:      make(chan Event),
+		Additions:       make(chan Event),
+		Removals:        make(chan Event),
+		Changes:         make(chan Event),
+		done:            make(chan struct{}),
+	}
 
 	// create the go routines used to grab the events and dispatch them accordingly
 	return d, nil
@@ -95,42 +116,70 @@ func newDispatcher(conn *dbus.Connection) (*dispatcher, error) {
 
 func (d *dispatcher) Init() {
 	log.Print("Init the dispatcher.")
-	go func() {
-		for msg := range d.additionsWatch.C {
-			var event Event
-			if err := msg.Args(&event.Path, &event.Props); err != nil {
-				log.Print(err)
-				continue
-			}
-			log.Print("New addition event for path ", event.Path, event.Props)
-			d.processAddition(event)
+	d.watch(d.additionsWatch, func(msg *dbus.Message) {
+		var event Event
+		if err := msg.Args(&event.Path, &event.Props); err != nil {
+			log.Print(err)
+			return
 		}
-	}()
+		log.Print("New addition event for path ", event.Path, event.Props)
+		d.processAddition(event)
+	})
+
+	d.watch(d.removalsWatch, func(msg *dbus.Message) {
+		log.Print("New removal event for path.")
+		var event Event
+		if err := msg.Args(&event.Path, &event.Interfaces); err != nil {
+			log.Print(err)
+			return
+		}
+		sort.Strings(event.Interfaces)
+		log.Print("Removal event is ", event.Path, " Interfaces: ", event.Interfaces)
+		d.processRemoval(event)
+	})
+
+	d.watch(d.propertiesWatch, func(msg *dbus.Message) {
+		var inter string
+		var changed VariantMap
+		var invalidated []string
+		if err := msg.Args(&inter, &changed, &invalidated); err != nil {
+			log.Print(err)
+			return
+		}
+		event := Event{msg.Path, InterfacesAndProperties{inter: changed}, nil}
+		d.processPropertiesChanged(event)
+	})
+}
 
+// watch starts a goroutine that handles the messages of the signal watch until the
+// dispatcher is closed.
+func (d *dispatcher) watch(w *dbus.SignalWatch, handle func(*dbus.Message)) {
+	d.wg.Add(1)
 	go func() {
-		for msg := range d.removalsWatch.C {
-			log.Print("New removal event for path.")
-			var event Event
-			if err := msg.Args(&event.Path, &event.Interfaces); err != nil {
-				log.Print(err)
-				continue
+		defer d.wg.Done()
+		for {
+			select {
+			case msg, ok := <-w.C:
+				if !ok {
+					return
+				}
+				handle(msg)
+			case <-d.done:
+				return
 			}
-			sort.Strings(event.Interfaces)
-			log.Print("Removal event is ", event.Path, " Interfaces: ", event.Interfaces)
-			d.processRemoval(event)
 		}
 	}()
 }
 
-func (d *dispatcher) free() {
+// Close cancels the signal watches and waits for the goroutines of the dispatcher to
+// be done.
+func (d *dispatcher) Close() {
 	log.Print("Cleaning dispatcher resources.")
-	// cancel all watches so that goroutines are done and close the
-	// channels
+	close(d.done)
 	d.additionsWatch.Cancel()
 	d.removalsWatch.Cancel()
-	close(d.Jobs)
-	close(d.Additions)
-	close(d.Removals)
+	d.propertiesWatch.Cancel()
+	d.wg.Wait()
 }
 
 func (d *dispatcher) processAddition(event Event) {
@@ -139,12 +188,16 @@ func (d *dispatcher) processAddition(event Event) {
 	if strings.HasPrefix(string(event.Path), jobPrefixPath) {
 		log.Print("Sending a new job event.")
 		select {
+		case <-d.done:
+			log.Println("Dropping event", event.Path, "because the dispatcher is closed")
 		case d.Jobs <- event:
 			log.Print("Sent event ", event.Path)
 		}
 	} else {
 		log.Print("Sending a new general add event.")
 		select {
+		case <-d.done:
+			log.Println("Dropping event", event.Path, "because the dispatcher is closed")
 		case d.Additions <- event:
 			log.Print("Sent event ", event.Path)
 		}
@@ -157,18 +210,40 @@ func (d *dispatcher) processRemoval(event Event) {
 	if strings.HasPrefix(string(event.Path), jobPrefixPath) {
 		log.Print("Sending a new remove job event.")
 		select {
+		case <-d.done:
+			log.Println("Dropping event", event.Path, "because the dispatcher is closed")
 		case d.Jobs <- event:
 			log.Println("Sent event", event.Path)
 		}
 	} else {
 		log.Print("Sending a new general remove event.")
 		select {
+		case <-d.done:
+			log.Println("Dropping event", event.Path, "because the dispatcher is closed")
 		case d.Removals <- event:
 			log.Println("Sent event", event.Path)
 		}
 	}
 }
 
-func cleanDispatcherData(d *dispatcher) {
-	d.free()
+func (d *dispatcher) processPropertiesChanged(event Event) {
+	log.Print("Processing a properties changed event from path ", event.Path)
+	// according to the object path we know if the even was a job one or not
+	if strings.HasPrefix(string(event.Path), jobPrefixPath) {
+		log.Print("Sending a new job changed event.")
+		select {
+		case <-d.done:
+			log.Println("Dropping event", event.Path, "because the dispatcher is closed")
+		case d.JobChanges <- event:
+			log.Println("Sent event", event.Path)
+		}
+	} else {
+		log.Print("Sending a new general changed event.")
+		select {
+		case <-d.done:
+			log.Println("Dropping event", event.Path, "because the dispatcher is closed")
+		case d.Changes <- event:
+			log.Println("Sent event", event.Path)
+		}
+	}
 }
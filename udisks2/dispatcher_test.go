@@ -32,10 +32,14 @@ type DispatcherTestSuite struct {
 var _ = Suite(&DispatcherTestSuite{})
 
 func (s *DispatcherTestSuite) SetUpTest(c *C) {
-	jobs_ch := make(chan Event)
-	additions_ch := make(chan Event)
-	remove_ch := make(chan Event)
-	s.d = &dispatcher{nil, nil, nil, jobs_ch, additions_ch, remove_ch}
+	s.d = &dispatcher{
+		Jobs:       make(chan Event),
+		JobChanges: make(chan Event),
+		Additions:  make(chan Event),
+		Removals:   make(chan Event),
+		Changes:    make(chan Event),
+		done:       make(chan struct{}),
+	}
 	s.completed = make(chan bool)
 }
 
@@ -100,3 +104,31 @@ func (s *DispatcherTestSuite) TestProcessRemovalDrive(c *C) {
 	s.d.processRemoval(event)
 	<-s.completed
 }
+
+func (s *DispatcherTestSuite) TestProcessPropertiesChangedJob(c *C) {
+	path := dbus.ObjectPath("/org/freedesktop/UDisks2/jobs/3")
+	props := make(map[string]VariantMap)
+	event := Event{path, props, nil}
+	// create a goroutine to test the event
+	go func() {
+		fwd_e := <-s.d.JobChanges
+		c.Assert(fwd_e.Path, Equals, path)
+		s.completed <- true
+	}()
+	s.d.processPropertiesChanged(event)
+	<-s.completed
+}
+
+func (s *DispatcherTestSuite) TestProcessPropertiesChangedDrive(c *C) {
+	path := dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/mmcblk1")
+	props := make(map[string]VariantMap)
+	event := Event{path, props, nil}
+	// create a goroutine to test the event
+	go func() {
+		fwd_e := <-s.d.Changes
+		c.Assert(fwd_e.Path, Equals, path)
+		s.completed <- true
+	}()
+	s.d.processPropertiesChanged(event)
+	<-s.completed
+}
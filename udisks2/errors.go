@@ -0,0 +1,75 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"log"
+	"strings"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+const dbusErrorPrefix = "org.freedesktop.UDisks2.Error."
+
+// dbusErrors maps the names of the UDisks2 errors to the errors returned by the package.
+var dbusErrors = map[string]error{
+	"Cancelled":              ErrCancelled,
+	"AlreadyCancelled":       ErrCancelled,
+	"DeviceBusy":             ErrBusy,
+	"AlreadyUnmounting":      ErrBusy,
+	"NotAuthorized":          ErrNotAuthorized,
+	"NotAuthorizedCanObtain": ErrNotAuthorized,
+	"NotAuthorizedDismissed": ErrNotAuthorized,
+	"MountedByOtherUser":     ErrNotAuthorized,
+	"OptionNotPermitted":     ErrNotAuthorized,
+	"NotMounted":             ErrNotMounted,
+	"AlreadyMounted":         ErrAlreadyMounted,
+	"NotSupported":           ErrNotSupported,
+	"Timedout":               ErrTimedOut,
+}
+
+// mapError returns the error of the package matching the UDisks2 error, other errors are
+// returned as they are.
+func mapError(err error) error {
+	dbusErr, ok := err.(*dbus.Error)
+	if !ok || !strings.HasPrefix(dbusErr.Name, dbusErrorPrefix) {
+		return err
+	}
+	name := strings.TrimPrefix(dbusErr.Name, dbusErrorPrefix)
+	mapped, ok := dbusErrors[name]
+	// older versions of UDisks2 report busy devices as generic failures
+	if !ok && name == "Failed" && strings.Contains(strings.ToLower(dbusErr.Message), "busy") {
+		mapped, ok = ErrBusy, true
+	}
+	if !ok {
+		return err
+	}
+	log.Println("UDisks2 error", dbusErr.Name, ":", dbusErr.Message)
+	return mapped
+}
+
+// callObject makes the D-Bus calls of call, it is changed by the tests.
+var callObject = (*dbus.ObjectProxy).Call
+
+// call calls the method and maps the UDisks2 errors to the errors of the package.
+func call(obj *dbus.ObjectProxy, iface, method string, args ...interface{}) (*dbus.Message, error) {
+	reply, err := callObject(obj, iface, method, args...)
+	return reply, mapError(err)
+}
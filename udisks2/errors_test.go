@@ -0,0 +1,66 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"errors"
+
+	"launchpad.net/go-dbus/v1"
+	. "launchpad.net/gocheck"
+)
+
+type ErrorsTestSuite struct{}
+
+var _ = Suite(&ErrorsTestSuite{})
+
+func (s *ErrorsTestSuite) TestMapKnownErrors(c *C) {
+	for name, expected := range map[string]error{
+		"org.freedesktop.UDisks2.Error.DeviceBusy":     ErrBusy,
+		"org.freedesktop.UDisks2.Error.NotAuthorized":  ErrNotAuthorized,
+		"org.freedesktop.UDisks2.Error.NotMounted":     ErrNotMounted,
+		"org.freedesktop.UDisks2.Error.AlreadyMounted": ErrAlreadyMounted,
+		"org.freedesktop.UDisks2.Error.Cancelled":      ErrCancelled,
+		"org.freedesktop.UDisks2.Error.NotSupported":   ErrNotSupported,
+		"org.freedesktop.UDisks2.Error.Timedout":       ErrTimedOut,
+	} {
+		err := mapError(&dbus.Error{Name: name, Message: "failed"})
+		c.Assert(err, Equals, expected, Commentf("error %s", name))
+	}
+}
+
+func (s *ErrorsTestSuite) TestMapFailedBusy(c *C) {
+	err := mapError(&dbus.Error{
+		Name:    "org.freedesktop.UDisks2.Error.Failed",
+		Message: "Error unmounting /dev/mmcblk1p1: target is busy",
+	})
+	c.Assert(err, Equals, ErrBusy)
+}
+
+func (s *ErrorsTestSuite) TestMapUnknownErrors(c *C) {
+	failed := &dbus.Error{Name: "org.freedesktop.UDisks2.Error.Failed", Message: "Error mounting"}
+	c.Assert(mapError(failed), Equals, failed)
+
+	other := &dbus.Error{Name: "org.freedesktop.DBus.Error.NoReply", Message: "timeout"}
+	c.Assert(mapError(other), Equals, other)
+
+	plain := errors.New("plain")
+	c.Assert(mapError(plain), Equals, plain)
+	c.Assert(mapError(nil), IsNil)
+}
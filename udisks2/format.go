@@ -0,0 +1,131 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+const (
+	FilesystemVfat  = "vfat"
+	FilesystemExfat = "exfat"
+	FilesystemExt4  = "ext4"
+	FilesystemNtfs  = "ntfs"
+	FilesystemSwap  = "swap"
+
+	PartitionTableDos = "dos"
+	PartitionTableGpt = "gpt"
+)
+
+var (
+	ErrUnsupportedFilesystem     = errors.New("unsupported filesystem type")
+	ErrUnsupportedPartitionTable = errors.New("unsupported partition table type")
+)
+
+// partitionTypes holds the partition type to be used for each of the supported filesystems
+// keyed by the partition table type.
+var partitionTypes = map[string]map[string]string{
+	PartitionTableDos: {
+		FilesystemVfat:  "0x0c",
+		FilesystemExfat: "0x07",
+		FilesystemExt4:  "0x83",
+		FilesystemNtfs:  "0x07",
+		FilesystemSwap:  "0x82",
+	},
+	PartitionTableGpt: {
+		FilesystemVfat:  "ebd0a0a2-b9e5-4433-87c0-68b6b72699c7",
+		FilesystemExfat: "ebd0a0a2-b9e5-4433-87c0-68b6b72699c7",
+		FilesystemExt4:  "0fc63daf-8483-4772-8e79-3d69d8477de4",
+		FilesystemNtfs:  "ebd0a0a2-b9e5-4433-87c0-68b6b72699c7",
+		FilesystemSwap:  "0657fd6d-a4ab-43c4-84e5-0933c84b4f4f",
+	},
+}
+
+// FormatOptions describes how a drive has to be formatted.
+type FormatOptions struct {
+	// Type is the filesystem to be created, one of vfat, exfat, ext4, ntfs or swap.
+	Type string
+	// Label is the volume label given to the new filesystem, if any.
+	Label string
+	// PartitionTable is the partition table to create, either dos or gpt. When empty
+	// the filesystem is created on the whole block device.
+	PartitionTable string
+	// Erase overwrites the whole device with zeros before creating the filesystem.
+	Erase bool
+	// Passphrase, when set, creates a LUKS container protected by it that holds the
+	// filesystem. The container is left unlocked once the format is done.
+	Passphrase string
+}
+
+// DefaultFormatOptions are the options used to format a drive when the caller has no
+// preference, a vfat filesystem on the whole device.
+var DefaultFormatOptions = FormatOptions{Type: FilesystemVfat}
+
+// String describes the options without revealing the passphrase so that they can be logged.
+func (o FormatOptions) String() string {
+	return fmt.Sprintf("{Type:%s Label:%s PartitionTable:%s Erase:%t Encrypted:%t}",
+		o.Type, o.Label, o.PartitionTable, o.Erase, o.Passphrase != "")
+}
+
+// validate returns an error if the filesystem or the partition table type are not supported.
+func (o FormatOptions) validate() error {
+	if _, ok := partitionTypes[PartitionTableDos][o.Type]; !ok {
+		log.Println("Cannot format with filesystem", o.Type)
+		return ErrUnsupportedFilesystem
+	}
+	if o.Label != "" {
+		if _, err := normalizeLabel(o.Type, o.Label); err != nil {
+			return err
+		}
+	}
+	if o.PartitionTable == "" {
+		return nil
+	}
+	if _, ok := partitionTypes[o.PartitionTable]; !ok {
+		log.Println("Cannot create partition table", o.PartitionTable)
+		return ErrUnsupportedPartitionTable
+	}
+	return nil
+}
+
+// partitionType returns the type of the partition that will hold the filesystem.
+func (o FormatOptions) partitionType() string {
+	return partitionTypes[o.PartitionTable][o.Type]
+}
+
+// formatOptions returns the options passed to the UDisks2 Format method.
+func (o FormatOptions) formatOptions() VariantMap {
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	if label, err := normalizeLabel(o.Type, o.Label); err == nil && label != "" {
+		options["label"] = dbus.Variant{label}
+	}
+	if o.Erase {
+		options["erase"] = dbus.Variant{"zero"}
+	}
+	if o.Passphrase != "" {
+		options["encrypt.passphrase"] = dbus.Variant{o.Passphrase}
+	}
+	return options
+}
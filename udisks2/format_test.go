@@ -0,0 +1,115 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"fmt"
+	"strings"
+
+	. "launchpad.net/gocheck"
+)
+
+type FormatOptionsTestSuite struct{}
+
+var _ = Suite(&FormatOptionsTestSuite{})
+
+func (s *FormatOptionsTestSuite) TestValidateDefault(c *C) {
+	c.Assert(DefaultFormatOptions.validate(), IsNil)
+}
+
+func (s *FormatOptionsTestSuite) TestValidateSupportedFilesystems(c *C) {
+	for _, fs := range []string{FilesystemVfat, FilesystemExfat, FilesystemExt4, FilesystemNtfs} {
+		opts := FormatOptions{Type: fs}
+		c.Assert(opts.validate(), IsNil)
+	}
+}
+
+func (s *FormatOptionsTestSuite) TestValidateUnsupportedFilesystem(c *C) {
+	opts := FormatOptions{Type: "btrfs"}
+	c.Assert(opts.validate(), Equals, ErrUnsupportedFilesystem)
+}
+
+func (s *FormatOptionsTestSuite) TestValidateMissingFilesystem(c *C) {
+	opts := FormatOptions{PartitionTable: PartitionTableGpt}
+	c.Assert(opts.validate(), Equals, ErrUnsupportedFilesystem)
+}
+
+func (s *FormatOptionsTestSuite) TestValidatePartitionTables(c *C) {
+	for _, table := range []string{PartitionTableDos, PartitionTableGpt} {
+		opts := FormatOptions{Type: FilesystemExfat, PartitionTable: table}
+		c.Assert(opts.validate(), IsNil)
+	}
+}
+
+func (s *FormatOptionsTestSuite) TestValidateUnsupportedPartitionTable(c *C) {
+	opts := FormatOptions{Type: FilesystemVfat, PartitionTable: "apm"}
+	c.Assert(opts.validate(), Equals, ErrUnsupportedPartitionTable)
+}
+
+func (s *FormatOptionsTestSuite) TestPartitionType(c *C) {
+	opts := FormatOptions{Type: FilesystemVfat, PartitionTable: PartitionTableDos}
+	c.Assert(opts.partitionType(), Equals, "0x0c")
+	opts = FormatOptions{Type: FilesystemExt4, PartitionTable: PartitionTableGpt}
+	c.Assert(opts.partitionType(), Equals, "0fc63daf-8483-4772-8e79-3d69d8477de4")
+}
+
+func (s *FormatOptionsTestSuite) TestFormatOptionsNoLabel(c *C) {
+	options := DefaultFormatOptions.formatOptions()
+	_, ok := options["label"]
+	c.Assert(ok, Equals, false)
+	c.Assert(options["auth.no_user_interaction"].Value, Equals, true)
+}
+
+func (s *FormatOptionsTestSuite) TestFormatOptionsLabel(c *C) {
+	opts := FormatOptions{Type: FilesystemExfat, Label: "CAMERA"}
+	options := opts.formatOptions()
+	c.Assert(options["label"].Value, Equals, "CAMERA")
+}
+
+func (s *FormatOptionsTestSuite) TestFormatOptionsErase(c *C) {
+	opts := FormatOptions{Type: FilesystemVfat, Erase: true}
+	options := opts.formatOptions()
+	c.Assert(options["erase"].Value, Equals, "zero")
+}
+
+func (s *FormatOptionsTestSuite) TestFormatOptionsPassphrase(c *C) {
+	opts := FormatOptions{Type: FilesystemExt4, Passphrase: "secret"}
+	options := opts.formatOptions()
+	c.Assert(options["encrypt.passphrase"].Value, Equals, "secret")
+	_, ok := DefaultFormatOptions.formatOptions()["encrypt.passphrase"]
+	c.Assert(ok, Equals, false)
+}
+
+func (s *FormatOptionsTestSuite) TestStringHidesPassphrase(c *C) {
+	opts := FormatOptions{Type: FilesystemExt4, Passphrase: "secret"}
+	c.Assert(strings.Contains(opts.String(), "secret"), Equals, false)
+	c.Assert(strings.Contains(fmt.Sprint(opts), "Encrypted:true"), Equals, true)
+}
+
+func (s *FormatOptionsTestSuite) TestValidateInvalidLabel(c *C) {
+	opts := FormatOptions{Type: FilesystemVfat, Label: "MORNINGSHIFT"}
+	c.Assert(opts.validate(), Equals, ErrInvalidLabel)
+}
+
+func (s *FormatOptionsTestSuite) TestFormatOptionsVfatLabelUppercase(c *C) {
+	opts := FormatOptions{Type: FilesystemVfat, Label: "shift a"}
+	options := opts.formatOptions()
+	c.Assert(options["label"].Value, Equals, "SHIFT A")
+}
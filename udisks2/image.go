@@ -0,0 +1,334 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+// imageChunkSize is the amount of bytes copied at once while writing and verifying.
+const imageChunkSize = 1024 * 1024
+
+var (
+	ErrImageTooLarge = errors.New("image is larger than the drive")
+	ErrVerifyFailed  = errors.New("data read back from the drive does not match the image")
+)
+
+// ImageProgress describes how far writing an image to a drive, or backing up a drive to
+// an image, has gone.
+type ImageProgress struct {
+	Drive dbus.ObjectPath
+	// Verifying is set once the image is written and is being read back.
+	Verifying bool
+	// Percent is the percentage of the image written or verified so far.
+	Percent float64
+}
+
+// SubscribeImageEvents returns a channel where the path of the drive is sent once an
+// image is written and verified, and a channel for the errors.
+func (u *UDisks2) SubscribeImageEvents(opts ...SubscribeOptions) (<-chan dbus.ObjectPath, <-chan error) {
+	o := subscribeOptions(opts)
+	imageCompleted := make(chan dbus.ObjectPath, o.Buffer)
+	imageErrors := make(chan error, o.Buffer)
+	u.bus.subscribe(topicImageCompleted, imageCompleted, o)
+	u.bus.subscribe(topicImageErrors, imageErrors, o)
+	return imageCompleted, imageErrors
+}
+
+// SubscribeImageProgress returns a channel where the progress of the image writes is sent.
+func (u *UDisks2) SubscribeImageProgress(opts ...SubscribeOptions) <-chan ImageProgress {
+	o := subscribeOptions(opts)
+	imageProgress := make(chan ImageProgress, o.Buffer)
+	u.bus.subscribe(topicImageProgress, imageProgress, o)
+	return imageProgress
+}
+
+// WriteImage writes the raw, gzip or xz compressed image to the drive and verifies it.
+// The result is reported with the image events.
+func (u *UDisks2) WriteImage(d *Drive, image string) {
+	go func() {
+		if err := u.WriteImageSync(context.Background(), d, image); err != nil {
+			u.bus.publish(topicImageErrors, err)
+			return
+		}
+		u.bus.publish(topicImageCompleted, d.Path)
+	}()
+}
+
+// WriteImageSync writes the raw, gzip or xz compressed image to the drive and verifies
+// it, progress is reported with the image progress events. The write stops when the
+// context is done, leaving the drive with a partial image.
+func (u *UDisks2) WriteImageSync(ctx context.Context, d *Drive, image string) error {
+	log.Println("Writing image", image, "to", d.Path)
+	src, err := openImage(image)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	blockPath, err := wholeBlock(d)
+	if err != nil {
+		return err
+	}
+	// the drive size is 0 for loop devices, the block device knows better
+	info, err := d.blockDevices[blockPath].BlockInfo()
+	if err != nil {
+		return err
+	}
+	if !src.compressed && uint64(src.size) > info.Size {
+		return ErrImageTooLarge
+	}
+
+	if err := u.unmountAll(d, DefaultUnmountMode); err != nil {
+		return err
+	}
+	if err := u.lockAll(d); err != nil {
+		return err
+	}
+
+	dev, err := u.openBlock(blockPath, "OpenForRestore")
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	progress := u.imageProgress(topicImageProgress, d.Path, false)
+	written, err := copyChunks(ctx, io.MultiWriter(dev, hash), src, func(int64) {
+		progress(src.progress())
+	})
+	if err == nil {
+		err = dev.Sync()
+	}
+	if closeErr := dev.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Println("Error after writing", written, "bytes of", image, ":", err)
+		return err
+	}
+
+	// the kernel has to notice the new partitions of the image
+	u.rescan(blockPath)
+
+	log.Println("Verifying", written, "bytes written to", blockPath)
+	dev, err = u.openBlock(blockPath, "OpenForBackup")
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+	readBack := sha256.New()
+	progress = u.imageProgress(topicImageProgress, d.Path, true)
+	if _, err := copyChunks(ctx, readBack, io.LimitReader(dev, written), func(n int64) {
+		progress(float64(n) / float64(written) * 100)
+	}); err != nil {
+		return err
+	}
+	if !bytes.Equal(hash.Sum(nil), readBack.Sum(nil)) {
+		return ErrVerifyFailed
+	}
+	return nil
+}
+
+// imageProgress returns a function that publishes the progress to the topic when the
+// percentage changes by at least one unit.
+func (u *UDisks2) imageProgress(t topic, p dbus.ObjectPath, verifying bool) func(float64) {
+	last := -1
+	return func(percent float64) {
+		if int(percent) == last {
+			return
+		}
+		last = int(percent)
+		u.bus.publish(t, ImageProgress{p, verifying, percent})
+	}
+}
+
+// openBlock opens the device file of the block device with one of the OpenForBackup,
+// OpenForRestore or OpenForBenchmark methods.
+func (u *UDisks2) openBlock(o dbus.ObjectPath, method string) (*os.File, error) {
+	obj := u.conn.Object(dbusName, o)
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	reply, err := call(obj, dbusBlockInterface, method, options)
+	if err != nil {
+		return nil, err
+	}
+	var fd dbus.UnixFD
+	if err := reply.Args(&fd); err != nil {
+		return nil, err
+	}
+	return os.NewFile(fd.Fd(), string(o)), nil
+}
+
+// rescan asks UDisks2 to read the block device again.
+func (u *UDisks2) rescan(o dbus.ObjectPath) {
+	obj := u.conn.Object(dbusName, o)
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	if _, err := call(obj, dbusBlockInterface, "Rescan", options); err != nil {
+		log.Println("Cannot rescan", o, ":", err)
+	}
+}
+
+// copyChunks copies src to dst until src ends or the context is done, progress is
+// called with the amount of bytes copied after each chunk.
+func copyChunks(ctx context.Context, dst io.Writer, src io.Reader, progress func(int64)) (int64, error) {
+	buf := make([]byte, imageChunkSize)
+	var copied int64
+	for {
+		select {
+		case <-ctx.Done():
+			return copied, ctx.Err()
+		default:
+		}
+		n, err := readChunk(src, buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return copied, err
+			}
+			copied += int64(n)
+			progress(copied)
+		}
+		if err == io.EOF {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, err
+		}
+	}
+}
+
+// readChunk fills buf from src. Unlike io.ReadFull the errors of src are returned as they
+// are, a truncated gzip stream ends with io.ErrUnexpectedEOF and that is not the end of
+// the image.
+func readChunk(src io.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := src.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// countingReader counts the bytes read, it can be read from any goroutine.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+func (c *countingReader) count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// imageSource reads the content of an image, decompressing it when needed.
+type imageSource struct {
+	file       *os.File
+	size       int64
+	compressed bool
+	read       *countingReader
+	r          io.Reader
+	cmd        *exec.Cmd
+}
+
+// openImage opens the image, images ending in .gz or .xz are decompressed.
+func openImage(image string) (*imageSource, error) {
+	file, err := os.Open(image)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s := &imageSource{file: file, size: info.Size(), read: &countingReader{r: file}}
+	switch name := strings.ToLower(image); {
+	case strings.HasSuffix(name, ".gz"):
+		s.compressed = true
+		if s.r, err = gzip.NewReader(s.read); err != nil {
+			file.Close()
+			return nil, err
+		}
+	case strings.HasSuffix(name, ".xz"):
+		// there is no xz decoder in the standard library
+		s.compressed = true
+		s.cmd = exec.Command("xz", "--decompress", "--stdout")
+		s.cmd.Stdin = s.read
+		if s.r, err = s.cmd.StdoutPipe(); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err := s.cmd.Start(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	default:
+		s.r = s.read
+	}
+	return s, nil
+}
+
+func (s *imageSource) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err == io.EOF && s.cmd != nil {
+		// a corrupted image ends the output early, which is only told by the exit status
+		cmd := s.cmd
+		s.cmd = nil
+		if waitErr := cmd.Wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// progress returns the percentage of the image file read so far.
+func (s *imageSource) progress() float64 {
+	if s.size == 0 {
+		return 100
+	}
+	return float64(s.read.count()) / float64(s.size) * 100
+}
+
+func (s *imageSource) Close() error {
+	err := s.file.Close()
+	if s.cmd != nil {
+		s.cmd.Process.Kill()
+		s.cmd.Wait()
+	}
+	return err
+}
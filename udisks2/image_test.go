@@ -0,0 +1,138 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+
+	"launchpad.net/go-dbus/v1"
+	. "launchpad.net/gocheck"
+)
+
+type ImageTestSuite struct {
+	content []byte
+}
+
+var _ = Suite(&ImageTestSuite{})
+
+func (s *ImageTestSuite) SetUpSuite(c *C) {
+	// a bit more than two chunks so that the last one is partial
+	s.content = bytes.Repeat([]byte("ciborium"), (2*imageChunkSize+512)/8)
+}
+
+func (s *ImageTestSuite) readImage(c *C, image string) []byte {
+	src, err := openImage(image)
+	c.Assert(err, IsNil)
+	defer src.Close()
+	var out bytes.Buffer
+	var calls int
+	n, err := copyChunks(context.Background(), &out, src, func(int64) { calls++ })
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(len(s.content)))
+	c.Assert(calls, Equals, 3)
+	c.Assert(src.progress(), Equals, float64(100))
+	return out.Bytes()
+}
+
+func (s *ImageTestSuite) TestRawImage(c *C) {
+	image := filepath.Join(c.MkDir(), "card.img")
+	c.Assert(ioutil.WriteFile(image, s.content, 0644), IsNil)
+	c.Assert(bytes.Equal(s.readImage(c, image), s.content), Equals, true)
+}
+
+func (s *ImageTestSuite) TestGzipImage(c *C) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write(s.content)
+	c.Assert(w.Close(), IsNil)
+	image := filepath.Join(c.MkDir(), "card.img.gz")
+	c.Assert(ioutil.WriteFile(image, compressed.Bytes(), 0644), IsNil)
+	c.Assert(bytes.Equal(s.readImage(c, image), s.content), Equals, true)
+}
+
+func (s *ImageTestSuite) TestTruncatedGzipImage(c *C) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write(s.content)
+	c.Assert(w.Close(), IsNil)
+	image := filepath.Join(c.MkDir(), "card.img.gz")
+	c.Assert(ioutil.WriteFile(image, compressed.Bytes()[:compressed.Len()/2], 0644), IsNil)
+	src, err := openImage(image)
+	c.Assert(err, IsNil)
+	defer src.Close()
+	_, err = copyChunks(context.Background(), ioutil.Discard, src, func(int64) {})
+	c.Assert(err, Equals, io.ErrUnexpectedEOF)
+}
+
+func (s *ImageTestSuite) TestXzImage(c *C) {
+	if _, err := exec.LookPath("xz"); err != nil {
+		c.Skip("xz is not installed")
+	}
+	image := filepath.Join(c.MkDir(), "card.img")
+	c.Assert(ioutil.WriteFile(image, s.content, 0644), IsNil)
+	c.Assert(exec.Command("xz", image).Run(), IsNil)
+	c.Assert(bytes.Equal(s.readImage(c, image+".xz"), s.content), Equals, true)
+}
+
+func (s *ImageTestSuite) TestCorruptedXzImage(c *C) {
+	if _, err := exec.LookPath("xz"); err != nil {
+		c.Skip("xz is not installed")
+	}
+	image := filepath.Join(c.MkDir(), "card.img.xz")
+	c.Assert(ioutil.WriteFile(image, []byte("not an xz image"), 0644), IsNil)
+	src, err := openImage(image)
+	c.Assert(err, IsNil)
+	defer src.Close()
+	_, err = copyChunks(context.Background(), ioutil.Discard, src, func(int64) {})
+	c.Assert(err, NotNil)
+}
+
+func (s *ImageTestSuite) TestCopyChunksCancelled(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	n, err := copyChunks(ctx, &out, bytes.NewReader(s.content), func(int64) { cancel() })
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(n, Equals, int64(imageChunkSize))
+}
+
+func (s *ImageTestSuite) TestImageTooLargeForBlockDevice(c *C) {
+	image := filepath.Join(c.MkDir(), "card.img")
+	c.Assert(ioutil.WriteFile(image, s.content, 0644), IsNil)
+
+	// the drive claims to be large enough but its whole block device is not
+	blockProps := make(InterfacesAndProperties)
+	blockProps[dbusBlockInterface] = map[string]dbus.Variant{
+		"Size":              dbus.Variant{uint64(len(s.content) - 1)},
+		"HintPartitionable": dbus.Variant{true},
+	}
+	d := &Drive{
+		Path:         testDrivePath,
+		info:         &DriveInfo{Size: 1 << 30},
+		blockDevices: map[dbus.ObjectPath]InterfacesAndProperties{testBlockPath: blockProps},
+	}
+	u := &UDisks2{}
+	c.Assert(u.WriteImageSync(context.Background(), d, image), Equals, ErrImageTooLarge)
+}
@@ -0,0 +1,453 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+// MissingInterfaceError is returned when the properties of an object do not hold the
+// interface that was requested.
+type MissingInterfaceError struct {
+	Interface string
+}
+
+func (e *MissingInterfaceError) Error() string {
+	return fmt.Sprintf("interface %s not found", e.Interface)
+}
+
+// PropertyError is returned when a property does not hold a value of the expected type.
+type PropertyError struct {
+	Interface string
+	Property  string
+	Value     interface{}
+}
+
+func (e *PropertyError) Error() string {
+	return fmt.Sprintf("property %s of %s has an unexpected value %v (%T)", e.Property, e.Interface, e.Value, e.Value)
+}
+
+// BlockInfo holds the properties of the org.freedesktop.UDisks2.Block interface.
+type BlockInfo struct {
+	Device              string
+	PreferredDevice     string
+	Size                uint64
+	ReadOnly            bool
+	Drive               dbus.ObjectPath
+	IdUsage             string
+	IdType              string
+	IdVersion           string
+	IdLabel             string
+	IdUUID              string
+	HintPartitionable   bool
+	HintSystem          bool
+	HintIgnore          bool
+	CryptoBackingDevice dbus.ObjectPath
+}
+
+// DriveInfo holds the properties of the org.freedesktop.UDisks2.Drive interface.
+type DriveInfo struct {
+	Vendor         string
+	Model          string
+	Revision       string
+	Serial         string
+	Id             string
+	Media          string
+	ConnectionBus  string
+	Size           uint64
+	Removable      bool
+	MediaRemovable bool
+	MediaAvailable bool
+	Ejectable      bool
+	CanPowerOff    bool
+}
+
+// FilesystemInfo holds the properties of the org.freedesktop.UDisks2.Filesystem interface.
+type FilesystemInfo struct {
+	MountPoints []string
+}
+
+// PartitionInfo holds the properties of the org.freedesktop.UDisks2.Partition interface.
+type PartitionInfo struct {
+	Number      uint32
+	Type        string
+	Offset      uint64
+	Size        uint64
+	Name        string
+	UUID        string
+	Table       dbus.ObjectPath
+	IsContainer bool
+	IsContained bool
+}
+
+// EncryptedInfo holds the properties of the org.freedesktop.UDisks2.Encrypted interface.
+type EncryptedInfo struct {
+	HintEncryptionType string
+	MetadataSize       uint64
+	CleartextDevice    dbus.ObjectPath
+}
+
+// Unlocked returns if the cleartext device of the encrypted block is available.
+func (e *EncryptedInfo) Unlocked() bool {
+	return e.CleartextDevice != "" && e.CleartextDevice != "/"
+}
+
+// LoopInfo holds the properties of the org.freedesktop.UDisks2.Loop interface.
+type LoopInfo struct {
+	BackingFile string
+	Autoclear   bool
+	SetupByUID  uint32
+}
+
+// JobInfo holds the properties of the org.freedesktop.UDisks2.Job interface.
+type JobInfo struct {
+	Operation       string
+	Progress        float64
+	ProgressValid   bool
+	Bytes           uint64
+	Rate            uint64
+	StartTime       uint64
+	ExpectedEndTime uint64
+	Objects         []dbus.ObjectPath
+	Cancelable      bool
+}
+
+// BlockInfo decodes the properties of the block interface.
+func (i InterfacesAndProperties) BlockInfo() (*BlockInfo, error) {
+	d, err := i.decoder(dbusBlockInterface)
+	if err != nil {
+		return nil, err
+	}
+	info := &BlockInfo{
+		Device:              d.byteString("Device"),
+		PreferredDevice:     d.byteString("PreferredDevice"),
+		Size:                d.uint64("Size"),
+		ReadOnly:            d.bool("ReadOnly"),
+		Drive:               d.objectPath("Drive"),
+		IdUsage:             d.string("IdUsage"),
+		IdType:              d.string("IdType"),
+		IdVersion:           d.string("IdVersion"),
+		IdLabel:             d.string("IdLabel"),
+		IdUUID:              d.string("IdUUID"),
+		HintPartitionable:   d.bool(partitionableProperty),
+		HintSystem:          d.bool("HintSystem"),
+		HintIgnore:          d.bool("HintIgnore"),
+		CryptoBackingDevice: d.objectPath("CryptoBackingDevice"),
+	}
+	return info, d.err
+}
+
+// DriveInfo decodes the properties of the drive interface.
+func (i InterfacesAndProperties) DriveInfo() (*DriveInfo, error) {
+	d, err := i.decoder(dbusDriveInterface)
+	if err != nil {
+		return nil, err
+	}
+	info := &DriveInfo{
+		Vendor:         d.string("Vendor"),
+		Model:          d.string("Model"),
+		Revision:       d.string("Revision"),
+		Serial:         d.string("Serial"),
+		Id:             d.string("Id"),
+		Media:          d.string("Media"),
+		ConnectionBus:  d.string("ConnectionBus"),
+		Size:           d.uint64("Size"),
+		Removable:      d.bool("Removable"),
+		MediaRemovable: d.bool("MediaRemovable"),
+		MediaAvailable: d.bool("MediaAvailable"),
+		Ejectable:      d.bool("Ejectable"),
+		CanPowerOff:    d.bool("CanPowerOff"),
+	}
+	return info, d.err
+}
+
+// FilesystemInfo decodes the properties of the filesystem interface.
+func (i InterfacesAndProperties) FilesystemInfo() (*FilesystemInfo, error) {
+	d, err := i.decoder(dbusFilesystemInterface)
+	if err != nil {
+		return nil, err
+	}
+	info := &FilesystemInfo{
+		MountPoints: d.byteStrings(mountPointsProperty),
+	}
+	return info, d.err
+}
+
+// PartitionInfo decodes the properties of the partition interface.
+func (i InterfacesAndProperties) PartitionInfo() (*PartitionInfo, error) {
+	d, err := i.decoder(dbusPartitionInterface)
+	if err != nil {
+		return nil, err
+	}
+	info := &PartitionInfo{
+		Number:      d.uint32("Number"),
+		Type:        d.string("Type"),
+		Offset:      d.uint64("Offset"),
+		Size:        d.uint64("Size"),
+		Name:        d.string("Name"),
+		UUID:        d.string(uuidProperty),
+		Table:       d.objectPath(tableProperty),
+		IsContainer: d.bool("IsContainer"),
+		IsContained: d.bool("IsContained"),
+	}
+	return info, d.err
+}
+
+// EncryptedInfo decodes the properties of the encrypted interface.
+func (i InterfacesAndProperties) EncryptedInfo() (*EncryptedInfo, error) {
+	d, err := i.decoder(dbusEncryptedInterface)
+	if err != nil {
+		return nil, err
+	}
+	info := &EncryptedInfo{
+		HintEncryptionType: d.string("HintEncryptionType"),
+		MetadataSize:       d.uint64("MetadataSize"),
+		CleartextDevice:    d.objectPath(cleartextDeviceProperty),
+	}
+	return info, d.err
+}
+
+// LoopInfo decodes the properties of the loop interface.
+func (i InterfacesAndProperties) LoopInfo() (*LoopInfo, error) {
+	d, err := i.decoder(dbusLoopInterface)
+	if err != nil {
+		return nil, err
+	}
+	info := &LoopInfo{
+		BackingFile: d.byteString("BackingFile"),
+		Autoclear:   d.bool("Autoclear"),
+		SetupByUID:  d.uint32("SetupByUID"),
+	}
+	return info, d.err
+}
+
+// JobInfo decodes the properties of the job interface.
+func (i InterfacesAndProperties) JobInfo() (*JobInfo, error) {
+	d, err := i.decoder(dbusJobInterface)
+	if err != nil {
+		return nil, err
+	}
+	info := &JobInfo{
+		Operation:       d.string(operationProperty),
+		Progress:        d.float64(progressProperty),
+		ProgressValid:   d.bool(progressValidProperty),
+		Bytes:           d.uint64(bytesProperty),
+		Rate:            d.uint64(rateProperty),
+		StartTime:       d.uint64("StartTime"),
+		ExpectedEndTime: d.uint64(expectedEndProperty),
+		Objects:         d.objectPaths(objectsProperty),
+		Cancelable:      d.bool(cancelableProperty),
+	}
+	return info, d.err
+}
+
+func (i InterfacesAndProperties) decoder(inter string) (*propertyDecoder, error) {
+	props, ok := i[inter]
+	if !ok {
+		return nil, &MissingInterfaceError{inter}
+	}
+	return &propertyDecoder{inter: inter, props: props}, nil
+}
+
+// propertyDecoder reads typed values out of the properties of an interface. Missing
+// properties decode to their zero value while the first property holding an unexpected
+// type is recorded in err.
+type propertyDecoder struct {
+	inter string
+	props VariantMap
+	err   error
+}
+
+func (d *propertyDecoder) value(name string) (interface{}, bool) {
+	variant, ok := d.props[name]
+	if !ok || variant.Value == nil {
+		return nil, false
+	}
+	return variant.Value, true
+}
+
+func (d *propertyDecoder) fail(name string, value interface{}) {
+	if d.err == nil {
+		d.err = &PropertyError{d.inter, name, value}
+	}
+}
+
+func (d *propertyDecoder) string(name string) string {
+	value, ok := d.value(name)
+	if !ok {
+		return ""
+	}
+	s, ok := value.(string)
+	if !ok {
+		d.fail(name, value)
+	}
+	return s
+}
+
+func (d *propertyDecoder) bool(name string) bool {
+	value, ok := d.value(name)
+	if !ok {
+		return false
+	}
+	b, ok := value.(bool)
+	if !ok {
+		d.fail(name, value)
+	}
+	return b
+}
+
+func (d *propertyDecoder) uint32(name string) uint32 {
+	value, ok := d.value(name)
+	if !ok {
+		return 0
+	}
+	n, ok := value.(uint32)
+	if !ok {
+		d.fail(name, value)
+	}
+	return n
+}
+
+func (d *propertyDecoder) uint64(name string) uint64 {
+	value, ok := d.value(name)
+	if !ok {
+		return 0
+	}
+	n, ok := value.(uint64)
+	if !ok {
+		d.fail(name, value)
+	}
+	return n
+}
+
+func (d *propertyDecoder) float64(name string) float64 {
+	value, ok := d.value(name)
+	if !ok {
+		return 0
+	}
+	f, ok := value.(float64)
+	if !ok {
+		d.fail(name, value)
+	}
+	return f
+}
+
+func (d *propertyDecoder) objectPath(name string) dbus.ObjectPath {
+	value, ok := d.value(name)
+	if !ok {
+		return ""
+	}
+	p, ok := toObjectPath(value)
+	if !ok {
+		d.fail(name, value)
+	}
+	return p
+}
+
+func (d *propertyDecoder) objectPaths(name string) []dbus.ObjectPath {
+	value, ok := d.value(name)
+	if !ok {
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		d.fail(name, value)
+		return nil
+	}
+	paths := make([]dbus.ObjectPath, v.Len())
+	for i := range paths {
+		if paths[i], ok = toObjectPath(v.Index(i).Interface()); !ok {
+			d.fail(name, value)
+			return nil
+		}
+	}
+	return paths
+}
+
+// byteString decodes a null terminated byte array, which is how UDisks2 exposes paths.
+func (d *propertyDecoder) byteString(name string) string {
+	value, ok := d.value(name)
+	if !ok {
+		return ""
+	}
+	s, ok := toByteString(value)
+	if !ok {
+		d.fail(name, value)
+	}
+	return s
+}
+
+// byteStrings decodes an array of null terminated byte arrays.
+func (d *propertyDecoder) byteStrings(name string) []string {
+	value, ok := d.value(name)
+	if !ok {
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		d.fail(name, value)
+		return nil
+	}
+	strs := make([]string, v.Len())
+	for i := range strs {
+		if strs[i], ok = toByteString(v.Index(i).Interface()); !ok {
+			d.fail(name, value)
+			return nil
+		}
+	}
+	return strs
+}
+
+func toObjectPath(value interface{}) (dbus.ObjectPath, bool) {
+	switch p := value.(type) {
+	case dbus.ObjectPath:
+		return p, true
+	case string:
+		return dbus.ObjectPath(p), true
+	}
+	return "", false
+}
+
+func toByteString(value interface{}) (string, bool) {
+	switch s := value.(type) {
+	case string:
+		return strings.TrimRight(s, "\x00"), true
+	case []byte:
+		return strings.TrimRight(string(s), "\x00"), true
+	}
+	// arrays nested in variants are not always decoded into a []byte
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return "", false
+	}
+	bytes := make([]byte, v.Len())
+	for i := range bytes {
+		b, ok := v.Index(i).Interface().(byte)
+		if !ok {
+			return "", false
+		}
+		bytes[i] = b
+	}
+	return strings.TrimRight(string(bytes), "\x00"), true
+}
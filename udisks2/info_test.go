@@ -0,0 +1,157 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"launchpad.net/go-dbus/v1"
+	. "launchpad.net/gocheck"
+)
+
+type InfoTestSuite struct {
+	properties InterfacesAndProperties
+}
+
+var _ = Suite(&InfoTestSuite{})
+
+func (s *InfoTestSuite) SetUpTest(c *C) {
+	s.properties = make(map[string]VariantMap)
+}
+
+func (s *InfoTestSuite) TestBlockInfoMissingInterface(c *C) {
+	_, err := s.properties.BlockInfo()
+	c.Assert(err, FitsTypeOf, &MissingInterfaceError{})
+}
+
+func (s *InfoTestSuite) TestBlockInfo(c *C) {
+	s.properties[dbusBlockInterface] = make(map[string]dbus.Variant)
+	s.properties[dbusBlockInterface]["Device"] = dbus.Variant{[]byte("/dev/mmcblk1p1\x00")}
+	s.properties[dbusBlockInterface]["Size"] = dbus.Variant{uint64(1024)}
+	s.properties[dbusBlockInterface]["Drive"] = dbus.Variant{dbus.ObjectPath("/org/freedesktop/UDisks2/drives/SD")}
+	s.properties[dbusBlockInterface]["IdType"] = dbus.Variant{"vfat"}
+	s.properties[dbusBlockInterface]["IdLabel"] = dbus.Variant{"CAMERA"}
+	s.properties[dbusBlockInterface]["HintSystem"] = dbus.Variant{true}
+
+	block, err := s.properties.BlockInfo()
+	c.Assert(err, IsNil)
+	c.Assert(block.Device, Equals, "/dev/mmcblk1p1")
+	c.Assert(block.Size, Equals, uint64(1024))
+	c.Assert(block.Drive, Equals, dbus.ObjectPath("/org/freedesktop/UDisks2/drives/SD"))
+	c.Assert(block.IdType, Equals, "vfat")
+	c.Assert(block.IdLabel, Equals, "CAMERA")
+	c.Assert(block.HintSystem, Equals, true)
+	c.Assert(block.HintPartitionable, Equals, false)
+}
+
+func (s *InfoTestSuite) TestBlockInfoWrongType(c *C) {
+	s.properties[dbusBlockInterface] = make(map[string]dbus.Variant)
+	s.properties[dbusBlockInterface]["HintSystem"] = dbus.Variant{"true"}
+
+	_, err := s.properties.BlockInfo()
+	c.Assert(err, FitsTypeOf, &PropertyError{})
+	c.Assert(err.(*PropertyError).Property, Equals, "HintSystem")
+}
+
+func (s *InfoTestSuite) TestDriveInfo(c *C) {
+	s.properties[dbusDriveInterface] = make(map[string]dbus.Variant)
+	s.properties[dbusDriveInterface]["Model"] = dbus.Variant{"SD Card Reader"}
+	s.properties[dbusDriveInterface]["Serial"] = dbus.Variant{"0123456789"}
+	s.properties[dbusDriveInterface]["MediaRemovable"] = dbus.Variant{true}
+
+	drive, err := s.properties.DriveInfo()
+	c.Assert(err, IsNil)
+	c.Assert(drive.Model, Equals, "SD Card Reader")
+	c.Assert(drive.Serial, Equals, "0123456789")
+	c.Assert(drive.MediaRemovable, Equals, true)
+}
+
+func (s *InfoTestSuite) TestFilesystemInfoNestedArrays(c *C) {
+	mountpoint := make([]interface{}, 0)
+	for _, b := range []byte("/media/card\x00") {
+		mountpoint = append(mountpoint, b)
+	}
+	s.properties[dbusFilesystemInterface] = make(map[string]dbus.Variant)
+	s.properties[dbusFilesystemInterface]["MountPoints"] = dbus.Variant{[]interface{}{mountpoint}}
+
+	fs, err := s.properties.FilesystemInfo()
+	c.Assert(err, IsNil)
+	c.Assert(fs.MountPoints, DeepEquals, []string{"/media/card"})
+}
+
+func (s *InfoTestSuite) TestFilesystemInfoWrongType(c *C) {
+	s.properties[dbusFilesystemInterface] = make(map[string]dbus.Variant)
+	s.properties[dbusFilesystemInterface]["MountPoints"] = dbus.Variant{[]int{1}}
+
+	_, err := s.properties.FilesystemInfo()
+	c.Assert(err, FitsTypeOf, &PropertyError{})
+}
+
+func (s *InfoTestSuite) TestPartitionInfo(c *C) {
+	s.properties[dbusPartitionInterface] = make(map[string]dbus.Variant)
+	s.properties[dbusPartitionInterface]["Number"] = dbus.Variant{uint32(1)}
+	s.properties[dbusPartitionInterface]["Table"] = dbus.Variant{dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/mmcblk1")}
+
+	partition, err := s.properties.PartitionInfo()
+	c.Assert(err, IsNil)
+	c.Assert(partition.Number, Equals, uint32(1))
+	c.Assert(partition.Table, Equals, dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/mmcblk1"))
+}
+
+func (s *InfoTestSuite) TestEncryptedInfo(c *C) {
+	s.properties[dbusEncryptedInterface] = make(map[string]dbus.Variant)
+	s.properties[dbusEncryptedInterface]["HintEncryptionType"] = dbus.Variant{"luks2"}
+	s.properties[dbusEncryptedInterface]["CleartextDevice"] = dbus.Variant{dbus.ObjectPath("/")}
+
+	encrypted, err := s.properties.EncryptedInfo()
+	c.Assert(err, IsNil)
+	c.Assert(encrypted.HintEncryptionType, Equals, "luks2")
+	c.Assert(encrypted.Unlocked(), Equals, false)
+	c.Assert(s.properties.isLocked(), Equals, true)
+
+	s.properties[dbusEncryptedInterface]["CleartextDevice"] = dbus.Variant{dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/dm_2d0")}
+	encrypted, err = s.properties.EncryptedInfo()
+	c.Assert(err, IsNil)
+	c.Assert(encrypted.Unlocked(), Equals, true)
+	c.Assert(s.properties.isLocked(), Equals, false)
+}
+
+func (s *InfoTestSuite) TestJobInfo(c *C) {
+	s.properties[dbusJobInterface] = make(map[string]dbus.Variant)
+	s.properties[dbusJobInterface]["Operation"] = dbus.Variant{"format-erase"}
+	s.properties[dbusJobInterface]["Progress"] = dbus.Variant{0.5}
+	s.properties[dbusJobInterface]["ProgressValid"] = dbus.Variant{true}
+	s.properties[dbusJobInterface]["Cancelable"] = dbus.Variant{true}
+	s.properties[dbusJobInterface]["Objects"] = dbus.Variant{[]interface{}{dbus.ObjectPath("/path/to/erased/fs")}}
+
+	job, err := s.properties.JobInfo()
+	c.Assert(err, IsNil)
+	c.Assert(job.Operation, Equals, formatErase)
+	c.Assert(job.Progress, Equals, 0.5)
+	c.Assert(job.ProgressValid, Equals, true)
+	c.Assert(job.Cancelable, Equals, true)
+	c.Assert(job.Objects, DeepEquals, []dbus.ObjectPath{"/path/to/erased/fs"})
+}
+
+func (s *InfoTestSuite) TestJobInfoWrongType(c *C) {
+	s.properties[dbusJobInterface] = make(map[string]dbus.Variant)
+	s.properties[dbusJobInterface]["Bytes"] = dbus.Variant{int32(5)}
+
+	_, err := s.properties.JobInfo()
+	c.Assert(err, FitsTypeOf, &PropertyError{})
+}
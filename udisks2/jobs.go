@@ -21,8 +21,9 @@ package udisks2
 
 import (
 	"log"
-	"runtime"
 	"sort"
+	"sync"
+	"time"
 
 	"launchpad.net/go-dbus/v1"
 )
@@ -34,26 +35,111 @@ type job struct {
 	WasCompleted bool
 }
 
+// JobProgress describes how far an UDisks2 job, such as a format, mount or unmount
+// operation, has gone.
+type JobProgress struct {
+	Path      dbus.ObjectPath
+	Operation string
+	Paths     []string
+	// Valid is false when UDisks2 cannot tell the progress of the job.
+	Valid bool
+	// Percent is the percentage of the job that has been completed.
+	Percent float64
+	// Bytes is the amount of bytes the job has to process, 0 if unknown.
+	Bytes uint64
+	// Processed is the estimated amount of bytes that have been processed so far.
+	Processed uint64
+	// Rate is the amount of bytes processed per second, 0 if unknown.
+	Rate uint64
+	// ExpectedEndTime is the time at which the job is expected to be done, zero if unknown.
+	ExpectedEndTime time.Time
+}
+
+// IsFormatJob returns if the progress belongs to either the erase or the mkfs step of a format.
+func (p JobProgress) IsFormatJob() bool {
+	return p.Operation == formatErase || p.Operation == formateMkfs
+}
+
+// Remaining returns the estimated time left for the job to be done, 0 if unknown.
+func (p JobProgress) Remaining() time.Duration {
+	if p.ExpectedEndTime.IsZero() {
+		return 0
+	}
+	if remaining := p.ExpectedEndTime.Sub(time.Now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// progress returns the progress of the job as per the last known job properties.
+func (j job) progress() JobProgress {
+	p := JobProgress{
+		Path:      j.Event.Path,
+		Operation: j.Operation,
+		Paths:     j.Paths,
+	}
+	props, ok := j.Event.Props[dbusJobInterface]
+	if !ok {
+		log.Println("Cannot read the progress of job", j.Event.Path, ":", &MissingInterfaceError{dbusJobInterface})
+		return p
+	}
+	// the fields are decoded on their own so that a property with an unexpected type
+	// does not drop the rest of the progress
+	decode := func(read func(d *propertyDecoder)) bool {
+		d := &propertyDecoder{inter: dbusJobInterface, props: props}
+		read(d)
+		if d.err != nil {
+			log.Println("Cannot read the progress of job", j.Event.Path, ":", d.err)
+		}
+		return d.err == nil
+	}
+	decode(func(d *propertyDecoder) { p.Bytes = d.uint64(bytesProperty) })
+	decode(func(d *propertyDecoder) { p.Rate = d.uint64(rateProperty) })
+	var progress float64
+	var valid bool
+	if decode(func(d *propertyDecoder) {
+		progress = d.float64(progressProperty)
+		valid = d.bool(progressValidProperty)
+	}) && valid {
+		p.Valid = true
+		p.Percent = progress * 100
+		p.Processed = uint64(progress * float64(p.Bytes))
+	}
+	// UDisks2 expresses the expected end time in microseconds since the epoch
+	var end uint64
+	if decode(func(d *propertyDecoder) { end = d.uint64(expectedEndProperty) }) && end != 0 {
+		p.ExpectedEndTime = time.Unix(0, int64(end)*int64(time.Microsecond))
+	}
+	return p
+}
+
 type jobManager struct {
 	onGoingJobs     map[dbus.ObjectPath]job
 	FormatEraseJobs chan job
 	FormatMkfsJobs  chan job
 	UnmountJobs     chan job
 	MountJobs       chan job
+	ProgressJobs    chan JobProgress
+	done            chan struct{}
+	wg              sync.WaitGroup
 }
 
 func newJobManager(d *dispatcher) *jobManager {
 	// listen to the diff job events and ensure that they are dealt with in the correct channel
-	ongoing := make(map[dbus.ObjectPath]job)
-	eraseChan := make(chan job)
-	mkfsChan := make(chan job)
-	unmountChan := make(chan job)
-	mountChan := make(chan job)
-	m := &jobManager{ongoing, eraseChan, mkfsChan, unmountChan, mountChan}
-	runtime.SetFinalizer(m, cleanJobData)
+	m := &jobManager{
+		onGoingJobs:     make(map[dbus.ObjectPath]job),
+		FormatEraseJobs: make(chan job),
+		FormatMkfsJobs:  make(chan job),
+		UnmountJobs:     make(chan job),
+		MountJobs:       make(chan job),
+		ProgressJobs:    make(chan JobProgress),
+		done:            make(chan struct{}),
+	}
 
 	// create a go routine that will filter the diff jobs
+	m.wg.Add(1)
 	go func() {
+		defer m.wg.Done()
 		for {
 			select {
 			case e := <-d.Jobs:
@@ -64,13 +150,26 @@ func newJobManager(d *dispatcher) *jobManager {
 				} else {
 					m.processAdditionEvent(e)
 				}
+			case e := <-d.JobChanges:
+				m.processChangeEvent(e)
+			case <-m.done:
+				log.Print("Job manager routine done")
+				return
 			}
 		}
-		log.Print("Job manager routine done")
 	}()
 	return m
 }
 
+// send forwards the job unless the manager is closed while waiting for a reader.
+func (m *jobManager) send(ch chan job, j job) {
+	select {
+	case ch <- j:
+	case <-m.done:
+		log.Println("Dropping job", j.Event.Path, "because the job manager is closed")
+	}
+}
+
 func (m *jobManager) processRemovalEvent(e Event) {
 	log.Println("Deal with job event removal", e.Path, e.Interfaces)
 	if job, ok := m.onGoingJobs[e.Path]; ok {
@@ -83,22 +182,22 @@ func (m *jobManager) processRemovalEvent(e Event) {
 
 			if job.Operation == formatErase {
 				log.Print("Sending completed erase job")
-				m.FormatEraseJobs <- job
+				m.send(m.FormatEraseJobs, job)
 			}
 
 			if job.Operation == formateMkfs {
 				log.Print("Sending completed mkfs job")
-				m.FormatMkfsJobs <- job
+				m.send(m.FormatMkfsJobs, job)
 			}
 
 			if job.Operation == unmountFs {
 				log.Print("Sending completed unmount job")
-				m.UnmountJobs <- job
+				m.send(m.UnmountJobs, job)
 			}
 
 			if job.Operation == mountFs {
 				log.Print("Sending complete mount job")
-				m.MountJobs <- job
+				m.send(m.MountJobs, job)
 			}
 
 			log.Print("Removed ongoing job for path", e.Path)
@@ -142,23 +241,56 @@ func (m *jobManager) processAdditionEvent(e Event) {
 
 	if j.Operation == formatErase {
 		log.Print("Sending erase job from addition.")
-		m.FormatEraseJobs <- j
+		m.send(m.FormatEraseJobs, j)
 	} else if j.Operation == formateMkfs {
 		log.Print("Sending format job from addition.")
-		m.FormatMkfsJobs <- j
+		m.send(m.FormatMkfsJobs, j)
 	} else if j.Operation == unmountFs {
 		log.Print("Sending nmount job from addition.")
-		m.UnmountJobs <- j
+		m.send(m.UnmountJobs, j)
 	} else {
 		log.Println("Ignoring job event with operation", j.Operation)
 	}
 }
 
-func (m *jobManager) free() {
-	close(m.FormatEraseJobs)
-	close(m.FormatMkfsJobs)
+// processChangeEvent merges the job properties carried by a PropertiesChanged signal into
+// the ongoing job and forwards the new progress of the job.
+func (m *jobManager) processChangeEvent(e Event) {
+	j, ok := m.onGoingJobs[e.Path]
+	if !ok {
+		log.Println("Ignoring property changes for unknown job", e.Path)
+		return
+	}
+	changed, ok := e.Props[dbusJobInterface]
+	if !ok {
+		log.Println("Ignoring property changes for path", e.Path, "because the job interface did not change")
+		return
+	}
+
+	j.Event.Path = e.Path
+	if j.Event.Props == nil {
+		j.Event.Props = make(InterfacesAndProperties)
+	}
+	props, ok := j.Event.Props[dbusJobInterface]
+	if !ok {
+		props = make(VariantMap)
+		j.Event.Props[dbusJobInterface] = props
+	}
+	for name, value := range changed {
+		props[name] = value
+	}
+	m.onGoingJobs[e.Path] = j
+
+	p := j.progress()
+	log.Println("Job", e.Path, "progress is", p.Percent, "valid:", p.Valid)
+	select {
+	case m.ProgressJobs <- p:
+	case <-m.done:
+	}
 }
 
-func cleanJobData(m *jobManager) {
-	m.free()
+// Close stops the goroutine of the job manager.
+func (m *jobManager) Close() {
+	close(m.done)
+	m.wg.Wait()
 }
@@ -20,6 +20,8 @@
 package udisks2
 
 import (
+	"time"
+
 	"launchpad.net/go-dbus/v1"
 	. "launchpad.net/gocheck"
 )
@@ -35,12 +37,15 @@ var _ = Suite(&JobManagerTestSuite{})
 
 func (s *JobManagerTestSuite) SetUpTest(c *C) {
 	s.ongoing = make(map[dbus.ObjectPath]job)
-	eraseChan := make(chan job)
-	mkfsChan := make(chan job)
-	unmountChan := make(chan job)
-	mountChan := make(chan job)
-
-	s.manager = &jobManager{s.ongoing, eraseChan, mkfsChan, unmountChan, mountChan}
+	s.manager = &jobManager{
+		onGoingJobs:     s.ongoing,
+		FormatEraseJobs: make(chan job),
+		FormatMkfsJobs:  make(chan job),
+		UnmountJobs:     make(chan job),
+		MountJobs:       make(chan job),
+		ProgressJobs:    make(chan JobProgress),
+		done:            make(chan struct{}),
+	}
 	s.completed = make(chan bool)
 }
 
@@ -192,3 +197,112 @@ func (s *JobManagerTestSuite) TestProcessRemovalEventMkfs(c *C) {
 	s.manager.processRemovalEvent(event)
 	<-s.completed
 }
+
+func (s *JobManagerTestSuite) TestProcessChangeEventMissing(c *C) {
+	path := dbus.ObjectPath("/org/freedesktop/UDisks2/jobs/1")
+	props := make(map[string]VariantMap)
+	props[dbusJobInterface] = make(map[string]dbus.Variant)
+	props[dbusJobInterface][progressProperty] = dbus.Variant{0.5}
+
+	event := Event{path, props, nil}
+	// nothing bad should happen
+	s.manager.processChangeEvent(event)
+}
+
+func (s *JobManagerTestSuite) TestProcessChangeEventProgress(c *C) {
+	path := dbus.ObjectPath("/org/freedesktop/UDisks2/jobs/1")
+
+	presentProps := make(map[string]VariantMap)
+	presentProps[dbusJobInterface] = make(map[string]dbus.Variant)
+	presentProps[dbusJobInterface][operationProperty] = dbus.Variant{formatErase}
+	presentProps[dbusJobInterface][bytesProperty] = dbus.Variant{uint64(1000)}
+	presentProps[dbusJobInterface][progressValidProperty] = dbus.Variant{true}
+	presentProps[dbusJobInterface][progressProperty] = dbus.Variant{0.0}
+	s.ongoing[path] = job{Event{path, presentProps, nil}, formatErase, nil, false}
+
+	go func() {
+		for p := range s.manager.ProgressJobs {
+			c.Assert(p.Path, Equals, path)
+			c.Assert(p.Operation, Equals, formatErase)
+			c.Assert(p.IsFormatJob(), Equals, true)
+			c.Assert(p.Valid, Equals, true)
+			c.Assert(p.Percent, Equals, 25.0)
+			c.Assert(p.Bytes, Equals, uint64(1000))
+			c.Assert(p.Processed, Equals, uint64(250))
+			c.Assert(p.Rate, Equals, uint64(100))
+			s.completed <- true
+		}
+	}()
+
+	props := make(map[string]VariantMap)
+	props[dbusJobInterface] = make(map[string]dbus.Variant)
+	props[dbusJobInterface][progressProperty] = dbus.Variant{0.25}
+	props[dbusJobInterface][rateProperty] = dbus.Variant{uint64(100)}
+
+	event := Event{path, props, nil}
+	s.manager.processChangeEvent(event)
+	<-s.completed
+	close(s.manager.ProgressJobs)
+}
+
+func (s *JobManagerTestSuite) TestJobProgressInvalid(c *C) {
+	props := make(map[string]VariantMap)
+	props[dbusJobInterface] = make(map[string]dbus.Variant)
+	props[dbusJobInterface][progressValidProperty] = dbus.Variant{false}
+	props[dbusJobInterface][progressProperty] = dbus.Variant{0.5}
+
+	p := job{Event{"/org/freedesktop/UDisks2/jobs/1", props, nil}, unmountFs, nil, false}.progress()
+	c.Assert(p.Valid, Equals, false)
+	c.Assert(p.Percent, Equals, 0.0)
+	c.Assert(p.IsFormatJob(), Equals, false)
+	c.Assert(p.Remaining(), Equals, time.Duration(0))
+}
+
+func (s *JobManagerTestSuite) TestJobProgressExpectedEndTime(c *C) {
+	end := time.Now().Add(time.Hour)
+	props := make(map[string]VariantMap)
+	props[dbusJobInterface] = make(map[string]dbus.Variant)
+	props[dbusJobInterface][expectedEndProperty] = dbus.Variant{uint64(end.UnixNano() / int64(time.Microsecond))}
+
+	p := job{Event{"/org/freedesktop/UDisks2/jobs/1", props, nil}, formatErase, nil, false}.progress()
+	c.Assert(p.ExpectedEndTime.Unix(), Equals, end.Unix())
+	c.Assert(p.Remaining() > 59*time.Minute, Equals, true)
+}
+
+func (s *JobManagerTestSuite) TestClose(c *C) {
+	d := &dispatcher{Jobs: make(chan Event), JobChanges: make(chan Event)}
+	m := newJobManager(d)
+
+	path := dbus.ObjectPath("/org/freedesktop/UDisks2/jobs/1")
+	props := make(map[string]VariantMap)
+	props[dbusJobInterface] = make(map[string]dbus.Variant)
+	props[dbusJobInterface][operationProperty] = dbus.Variant{formatErase}
+	// nobody reads the erase job so the manager blocks until it is closed
+	d.Jobs <- Event{path, props, nil}
+
+	closed := make(chan bool)
+	go func() {
+		m.Close()
+		closed <- true
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		c.Fatal("job manager was not closed")
+	}
+}
+
+func (s *JobManagerTestSuite) TestJobProgressMalformedProperty(c *C) {
+	props := make(map[string]VariantMap)
+	props[dbusJobInterface] = make(map[string]dbus.Variant)
+	props[dbusJobInterface][bytesProperty] = dbus.Variant{uint64(1000)}
+	props[dbusJobInterface][rateProperty] = dbus.Variant{"fast"}
+	props[dbusJobInterface][progressValidProperty] = dbus.Variant{true}
+	props[dbusJobInterface][progressProperty] = dbus.Variant{0.5}
+
+	p := job{Event{"/org/freedesktop/UDisks2/jobs/1", props, nil}, formatErase, nil, false}.progress()
+	c.Assert(p.Rate, Equals, uint64(0))
+	c.Assert(p.Valid, Equals, true)
+	c.Assert(p.Percent, Equals, 50.0)
+	c.Assert(p.Processed, Equals, uint64(500))
+}
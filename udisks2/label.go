@@ -0,0 +1,105 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"unicode/utf16"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+var ErrInvalidLabel = errors.New("invalid label for the filesystem")
+
+// labelRule describes the labels a filesystem accepts.
+type labelRule struct {
+	// maxBytes is the maximum length of the label in bytes, 0 when not limited in bytes.
+	maxBytes int
+	// maxUnits is the maximum length of the label in UTF-16 code units, 0 when not limited
+	// in code units.
+	maxUnits int
+	// invalid holds the characters that cannot be part of the label.
+	invalid string
+	// upper is set when the filesystem stores the label in uppercase.
+	upper bool
+	// ascii is set when only printable ASCII characters are allowed.
+	ascii bool
+}
+
+var labelRules = map[string]labelRule{
+	FilesystemVfat:  {maxBytes: 11, invalid: "\"*+,./:;<=>?[\\]|", upper: true, ascii: true},
+	FilesystemExfat: {maxUnits: 15, invalid: "\"*/:<>?\\|"},
+	FilesystemExt4:  {maxBytes: 16},
+	FilesystemNtfs:  {maxUnits: 128},
+	FilesystemSwap:  {maxBytes: 15},
+}
+
+// normalizeLabel returns the label as it is stored by the filesystem or ErrInvalidLabel
+// if the filesystem cannot hold it.
+func normalizeLabel(fsType, label string) (string, error) {
+	rule, ok := labelRules[fsType]
+	if !ok {
+		return "", ErrUnsupportedFilesystem
+	}
+	if rule.upper {
+		label = strings.ToUpper(label)
+	}
+	if rule.maxBytes > 0 && len(label) > rule.maxBytes {
+		log.Println("Label", label, "is longer than", rule.maxBytes, "bytes")
+		return "", ErrInvalidLabel
+	}
+	if rule.maxUnits > 0 && len(utf16.Encode([]rune(label))) > rule.maxUnits {
+		log.Println("Label", label, "is longer than", rule.maxUnits, "characters")
+		return "", ErrInvalidLabel
+	}
+	for _, r := range label {
+		if r < 0x20 || r == 0x7f || (rule.ascii && r > 0x7e) || strings.ContainsRune(rule.invalid, r) {
+			log.Println("Label", label, "holds invalid character", r)
+			return "", ErrInvalidLabel
+		}
+	}
+	return label, nil
+}
+
+// SetLabel changes the label of the filesystem of the block device after checking that
+// the filesystem accepts it. FAT labels are stored in uppercase.
+func (u *UDisks2) SetLabel(p dbus.ObjectPath, label string) error {
+	obj := u.conn.Object(dbusName, p)
+	reply, err := call(obj, dbusPropertiesInterface, "Get", dbusBlockInterface, "IdType")
+	if err != nil {
+		return err
+	}
+	idType := dbus.Variant{}
+	if err := reply.Args(&idType); err != nil {
+		return err
+	}
+	fsType, _ := idType.Value.(string)
+	if label, err = normalizeLabel(fsType, label); err != nil {
+		return err
+	}
+
+	log.Println("Setting label of", p, "to", label)
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	_, err = call(obj, dbusFilesystemInterface, "SetLabel", label, options)
+	return err
+}
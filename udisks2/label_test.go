@@ -0,0 +1,67 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	. "launchpad.net/gocheck"
+)
+
+type LabelTestSuite struct{}
+
+var _ = Suite(&LabelTestSuite{})
+
+func (s *LabelTestSuite) TestVfatUppercase(c *C) {
+	label, err := normalizeLabel(FilesystemVfat, "shift a")
+	c.Assert(err, IsNil)
+	c.Assert(label, Equals, "SHIFT A")
+}
+
+func (s *LabelTestSuite) TestVfatTooLong(c *C) {
+	_, err := normalizeLabel(FilesystemVfat, "MORNINGSHIFT")
+	c.Assert(err, Equals, ErrInvalidLabel)
+}
+
+func (s *LabelTestSuite) TestVfatInvalidCharacters(c *C) {
+	for _, label := range []string{"A/B", "A:B", "A?B", "CAFÉ"} {
+		_, err := normalizeLabel(FilesystemVfat, label)
+		c.Assert(err, Equals, ErrInvalidLabel, Commentf("label %q", label))
+	}
+}
+
+func (s *LabelTestSuite) TestExfatLength(c *C) {
+	label, err := normalizeLabel(FilesystemExfat, "Morning shift 1")
+	c.Assert(err, IsNil)
+	c.Assert(label, Equals, "Morning shift 1")
+	_, err = normalizeLabel(FilesystemExfat, "Morning shift 12")
+	c.Assert(err, Equals, ErrInvalidLabel)
+}
+
+func (s *LabelTestSuite) TestExt4LengthInBytes(c *C) {
+	_, err := normalizeLabel(FilesystemExt4, "ééééééééé")
+	c.Assert(err, Equals, ErrInvalidLabel)
+	label, err := normalizeLabel(FilesystemExt4, "Night shift")
+	c.Assert(err, IsNil)
+	c.Assert(label, Equals, "Night shift")
+}
+
+func (s *LabelTestSuite) TestUnsupportedFilesystem(c *C) {
+	_, err := normalizeLabel("btrfs", "DATA")
+	c.Assert(err, Equals, ErrUnsupportedFilesystem)
+}
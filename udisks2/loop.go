@@ -0,0 +1,90 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"log"
+	"os"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+// LoopSetup attaches the image file to a loop device and returns the path of the loop
+// block device. The loop device and its partitions are reported and mounted like the
+// block devices of any removable drive.
+func (u *UDisks2) LoopSetup(file string, readOnly bool) (dbus.ObjectPath, error) {
+	flag := os.O_RDWR
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(file, flag, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fd, err := dbus.NewUnixFD(f.Fd())
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	log.Println("Setting up loop device for", file)
+	var loopPath dbus.ObjectPath
+	obj := u.conn.Object(dbusName, dbusManagerObject)
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	options["read-only"] = dbus.Variant{readOnly}
+	reply, err := call(obj, dbusManagerInterface, "LoopSetup", fd, options)
+	if err != nil {
+		return "", err
+	}
+	if err := reply.Args(&loopPath); err != nil {
+		return "", err
+	}
+	return loopPath, nil
+}
+
+// LoopDelete unmounts the filesystems of the loop device and detaches it from its
+// image file.
+func (u *UDisks2) LoopDelete(p dbus.ObjectPath) error {
+	u.mapLock.Lock()
+	d, ok := u.drives[p]
+	var snapshot Drive
+	if ok {
+		snapshot = d.snapshot()
+	}
+	u.mapLock.Unlock()
+
+	if ok {
+		if err := u.unmountAll(&snapshot, DefaultUnmountMode); err != nil {
+			return err
+		}
+		if err := u.lockAll(&snapshot); err != nil {
+			return err
+		}
+	}
+
+	log.Println("Deleting loop device", p)
+	obj := u.conn.Object(dbusName, p)
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	_, err := call(obj, dbusLoopInterface, "Delete", options)
+	return err
+}
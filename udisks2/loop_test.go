@@ -0,0 +1,171 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"launchpad.net/go-dbus/v1"
+	. "launchpad.net/gocheck"
+)
+
+const testLoopPath = dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/loop0")
+
+type LoopTestSuite struct {
+	u     *UDisks2
+	calls []string
+	args  map[string][]interface{}
+	// replies holds the values returned by the calls, keyed like calls
+	replies map[string]interface{}
+}
+
+var _ = Suite(&LoopTestSuite{})
+
+func (s *LoopTestSuite) SetUpTest(c *C) {
+	s.u = NewStorageWatcher(&dbus.Connection{}, FilesystemVfat)
+	s.calls = nil
+	s.args = make(map[string][]interface{})
+	s.replies = make(map[string]interface{})
+	callObject = func(obj *dbus.ObjectProxy, iface, method string, args ...interface{}) (*dbus.Message, error) {
+		name := method
+		if method == "Get" {
+			name += " " + args[1].(string)
+		}
+		s.calls = append(s.calls, name)
+		s.args[name] = args
+		reply := dbus.NewSignalMessage("/", iface, method)
+		if value, ok := s.replies[name]; ok {
+			c.Assert(reply.AppendArgs(value), IsNil)
+		}
+		return reply, nil
+	}
+}
+
+func (s *LoopTestSuite) TearDownTest(c *C) {
+	callObject = (*dbus.ObjectProxy).Call
+}
+
+// openFlags returns the access mode of the file descriptor.
+func openFlags(c *C, fd *dbus.UnixFD) int {
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd.Fd(), syscall.F_GETFL, 0)
+	c.Assert(errno, Equals, syscall.Errno(0))
+	return int(flags) & syscall.O_ACCMODE
+}
+
+func (s *LoopTestSuite) loopSetup(c *C, readOnly bool) int {
+	image := filepath.Join(c.MkDir(), "card.img")
+	c.Assert(ioutil.WriteFile(image, make([]byte, 4096), 0644), IsNil)
+	s.replies["LoopSetup"] = testLoopPath
+
+	var flags int
+	setup := callObject
+	callObject = func(obj *dbus.ObjectProxy, iface, method string, args ...interface{}) (*dbus.Message, error) {
+		// the file descriptor is only open during the call
+		flags = openFlags(c, args[0].(*dbus.UnixFD))
+		return setup(obj, iface, method, args...)
+	}
+
+	p, err := s.u.LoopSetup(image, readOnly)
+	c.Assert(err, IsNil)
+	c.Assert(p, Equals, testLoopPath)
+	c.Assert(s.calls, DeepEquals, []string{"LoopSetup"})
+	options := s.args["LoopSetup"][1].(VariantMap)
+	c.Assert(options["read-only"], Equals, dbus.Variant{readOnly})
+	c.Assert(options["auth.no_user_interaction"], Equals, dbus.Variant{true})
+	return flags
+}
+
+func (s *LoopTestSuite) TestLoopSetup(c *C) {
+	c.Assert(s.loopSetup(c, false), Equals, syscall.O_RDWR)
+}
+
+func (s *LoopTestSuite) TestLoopSetupReadOnly(c *C) {
+	c.Assert(s.loopSetup(c, true), Equals, syscall.O_RDONLY)
+}
+
+func (s *LoopTestSuite) TestLoopSetupMissingFile(c *C) {
+	_, err := s.u.LoopSetup(filepath.Join(c.MkDir(), "missing.img"), true)
+	c.Assert(err, NotNil)
+	c.Assert(s.calls, HasLen, 0)
+}
+
+func (s *LoopTestSuite) TestLoopDeleteUnknown(c *C) {
+	c.Assert(s.u.LoopDelete(testLoopPath), IsNil)
+	c.Assert(s.calls, DeepEquals, []string{"Delete"})
+}
+
+func (s *LoopTestSuite) TestLoopDelete(c *C) {
+	// an encrypted image holding a mounted filesystem
+	loopProps := make(InterfacesAndProperties)
+	loopProps[dbusBlockInterface] = map[string]dbus.Variant{"Drive": dbus.Variant{dbus.ObjectPath("/")}}
+	loopProps[dbusEncryptedInterface] = map[string]dbus.Variant{
+		cleartextDeviceProperty: dbus.Variant{dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/dm_2d0")},
+	}
+	s.u.drives[testLoopPath] = &Drive{
+		Path:         testLoopPath,
+		blockDevices: map[dbus.ObjectPath]InterfacesAndProperties{testLoopPath: loopProps},
+	}
+	s.replies["Get "+mountPointsProperty] = dbus.Variant{[][]byte{[]byte("/media/phablet/card\x00")}}
+	s.replies["Get "+cleartextDeviceProperty] = dbus.Variant{dbus.ObjectPath("/")}
+
+	c.Assert(s.u.LoopDelete(testLoopPath), IsNil)
+	c.Assert(s.calls, DeepEquals, []string{
+		"Get " + mountPointsProperty,
+		"Unmount",
+		"Get " + cleartextDeviceProperty,
+		"Lock",
+		"Delete",
+	})
+	options := s.args["Unmount"][0].(VariantMap)
+	_, forced := options["force"]
+	c.Assert(forced, Equals, false)
+}
+
+func (s *LoopTestSuite) TestLoopDeleteBusy(c *C) {
+	s.u.drives[testLoopPath] = &Drive{
+		Path:         testLoopPath,
+		blockDevices: map[dbus.ObjectPath]InterfacesAndProperties{testLoopPath: make(InterfacesAndProperties)},
+	}
+	s.replies["Get "+mountPointsProperty] = dbus.Variant{[][]byte{[]byte("/media/phablet/card\x00")}}
+	unmount := callObject
+	callObject = func(obj *dbus.ObjectProxy, iface, method string, args ...interface{}) (*dbus.Message, error) {
+		reply, _ := unmount(obj, iface, method, args...)
+		if method == "Unmount" {
+			return nil, &dbus.Error{Name: dbusErrorPrefix + "DeviceBusy", Message: "target is busy"}
+		}
+		return reply, nil
+	}
+	procDir = c.MkDir()
+	sleep = func(time.Duration) {}
+	defer func() {
+		procDir = "/proc"
+		sleep = time.Sleep
+	}()
+
+	err := s.u.LoopDelete(testLoopPath)
+	c.Assert(IsBusy(err), Equals, true)
+	// the loop device is not deleted while its filesystem is in use
+	for _, call := range s.calls {
+		c.Assert(call, Not(Equals), "Delete")
+	}
+}
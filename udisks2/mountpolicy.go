@@ -0,0 +1,105 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"strings"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+// MountPolicy decides the options used to mount each filesystem. The options of the
+// first match are used, looking up the filesystem UUID and the drive serial in Devices,
+// then the filesystem type in Filesystems and falling back to Default.
+type MountPolicy struct {
+	Default     []string            `json:"default"`
+	Filesystems map[string][]string `json:"filesystems"`
+	Devices     map[string][]string `json:"devices"`
+}
+
+// DefaultMountPolicy does not allow executables nor setuid binaries on any filesystem.
+var DefaultMountPolicy = MountPolicy{
+	Default: []string{"nosuid", "nodev", "noexec"},
+	Filesystems: map[string][]string{
+		FilesystemVfat:  {"nosuid", "nodev", "noexec", "flush"},
+		FilesystemExfat: {"nosuid", "nodev", "noexec"},
+	},
+}
+
+// options returns the mount options of the filesystem as expected by the UDisks2 Mount
+// method, a comma separated list.
+func (p MountPolicy) options(fsType, uuid, serial string) string {
+	for _, key := range []string{uuid, serial} {
+		if key == "" {
+			continue
+		}
+		if opts, ok := p.Devices[key]; ok {
+			return strings.Join(opts, ",")
+		}
+	}
+	if opts, ok := p.Filesystems[fsType]; ok {
+		return strings.Join(opts, ",")
+	}
+	return strings.Join(p.Default, ",")
+}
+
+// readOnlyOptions returns the mount options with rw replaced by ro.
+func readOnlyOptions(options string) string {
+	opts := []string{"ro"}
+	for _, opt := range strings.Split(options, ",") {
+		if opt != "" && opt != "rw" && opt != "ro" {
+			opts = append(opts, opt)
+		}
+	}
+	return strings.Join(opts, ",")
+}
+
+// SetMountPolicy replaces the policy used to mount the filesystems from now on.
+func (u *UDisks2) SetMountPolicy(p MountPolicy) {
+	u.mapLock.Lock()
+	defer u.mapLock.Unlock()
+	u.mountPolicy = p
+}
+
+// mountOptions returns the mount options of the block device following the mount policy,
+// filesystems with an AutomountReadOnly rule are always mounted read only.
+func (u *UDisks2) mountOptions(o dbus.ObjectPath) string {
+	u.mapLock.Lock()
+	defer u.mapLock.Unlock()
+	var fsType, uuid, serial string
+	readOnly := false
+	for _, d := range u.drives {
+		props, ok := d.blockDevices[o]
+		if !ok {
+			continue
+		}
+		if block, err := props.BlockInfo(); err == nil {
+			fsType, uuid = block.IdType, block.IdUUID
+		}
+		serial = d.Serial()
+		readOnly = u.automountAction(o, props) == AutomountReadOnly
+		break
+	}
+	options := u.mountPolicy.options(fsType, uuid, serial)
+	if readOnly {
+		return readOnlyOptions(options)
+	}
+	return options
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	. "launchpad.net/gocheck"
+)
+
+type MountPolicyTestSuite struct {
+	policy MountPolicy
+}
+
+var _ = Suite(&MountPolicyTestSuite{})
+
+func (s *MountPolicyTestSuite) SetUpTest(c *C) {
+	s.policy = MountPolicy{
+		Default:     []string{"nosuid", "noexec"},
+		Filesystems: map[string][]string{FilesystemVfat: {"noexec", "flush", "umask=0077"}},
+		Devices: map[string][]string{
+			"1234-ABCD":  {"ro"},
+			"SERIAL0001": {"sync"},
+		},
+	}
+}
+
+func (s *MountPolicyTestSuite) TestDefault(c *C) {
+	c.Assert(s.policy.options(FilesystemExt4, "", ""), Equals, "nosuid,noexec")
+}
+
+func (s *MountPolicyTestSuite) TestFilesystem(c *C) {
+	c.Assert(s.policy.options(FilesystemVfat, "5678-EF01", "SERIAL0002"), Equals, "noexec,flush,umask=0077")
+}
+
+func (s *MountPolicyTestSuite) TestDeviceUUID(c *C) {
+	c.Assert(s.policy.options(FilesystemVfat, "1234-ABCD", "SERIAL0001"), Equals, "ro")
+}
+
+func (s *MountPolicyTestSuite) TestDeviceSerial(c *C) {
+	c.Assert(s.policy.options(FilesystemVfat, "5678-EF01", "SERIAL0001"), Equals, "sync")
+}
+
+func (s *MountPolicyTestSuite) TestEmptyPolicy(c *C) {
+	c.Assert(MountPolicy{}.options(FilesystemVfat, "", ""), Equals, "")
+}
+
+func (s *MountPolicyTestSuite) TestDefaultPolicyNoExec(c *C) {
+	for _, fs := range []string{FilesystemVfat, FilesystemExfat, FilesystemExt4, FilesystemNtfs} {
+		c.Assert(DefaultMountPolicy.options(fs, "", ""), Matches, ".*noexec.*")
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"launchpad.net/go-dbus/v1"
+)
+
+// partitionAlignment is the alignment of the partitions, it keeps them on erase block
+// boundaries on most cards.
+const partitionAlignment = 1024 * 1024
+
+var (
+	ErrNoPartitions          = errors.New("no partitions in the layout")
+	ErrTooManyPartitions     = errors.New("too many partitions for the partition table")
+	ErrInvalidPartitionSize  = errors.New("only the last partition can use the remaining space")
+	ErrNoPartitionableDevice = errors.New("drive has no partitionable block device")
+)
+
+// maxPartitions holds the maximum number of partitions for each partition table, dos
+// tables are limited to primary partitions.
+var maxPartitions = map[string]int{
+	PartitionTableDos: 4,
+	PartitionTableGpt: 128,
+}
+
+// Partition describes a partition to be created.
+type Partition struct {
+	// Size is the size of the partition in bytes, 0 uses the remaining space.
+	Size uint64
+	// Type is the filesystem created on the partition.
+	Type string
+	// Label is the volume label given to the filesystem, if any.
+	Label string
+	// Name is the name of the partition, only used for gpt partition tables.
+	Name string
+}
+
+// PartitionLayout describes the partition table and the partitions of a drive.
+type PartitionLayout struct {
+	// PartitionTable is the partition table to create, either dos or gpt.
+	PartitionTable string
+	Partitions     []Partition
+	// Erase overwrites the whole device with zeros before creating the partition table.
+	Erase bool
+}
+
+// validate returns an error if the partition table cannot hold the partitions.
+func (l PartitionLayout) validate() error {
+	max, ok := maxPartitions[l.PartitionTable]
+	if !ok {
+		log.Println("Cannot create partition table", l.PartitionTable)
+		return ErrUnsupportedPartitionTable
+	}
+	if len(l.Partitions) == 0 {
+		return ErrNoPartitions
+	}
+	if len(l.Partitions) > max {
+		return ErrTooManyPartitions
+	}
+	for i, p := range l.Partitions {
+		if p.Size == 0 && i != len(l.Partitions)-1 {
+			return ErrInvalidPartitionSize
+		}
+		if err := p.formatOptions(l.PartitionTable).validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatOptions returns the options used to format the partition.
+func (p Partition) formatOptions(partitionTable string) FormatOptions {
+	return FormatOptions{Type: p.Type, Label: p.Label, PartitionTable: partitionTable}
+}
+
+// wholeBlock returns the block device that spans the whole drive.
+func wholeBlock(d *Drive) (dbus.ObjectPath, error) {
+	for blockPath, block := range d.blockDevices {
+		if block.isPartitionable() {
+			return blockPath, nil
+		}
+	}
+	return "", ErrNoPartitionableDevice
+}
+
+// alignUp rounds the offset up to the partition alignment.
+func alignUp(offset uint64) uint64 {
+	return (offset + partitionAlignment - 1) / partitionAlignment * partitionAlignment
+}
+
+// Repartition replaces the partitions of the drive with the ones in the layout and
+// formats them. Errors are reported with the format events.
+func (u *UDisks2) Repartition(d *Drive, layout PartitionLayout) {
+	go func() {
+		if err := u.syncRepartition(d, layout); err != nil {
+			u.bus.publish(topicFormatErrors, err)
+		}
+	}()
+}
+
+// RepartitionSync replaces the partitions of the drive with the ones in the layout and
+// returns once they are formatted. If the context is done before that the format jobs
+// are cancelled.
+func (u *UDisks2) RepartitionSync(ctx context.Context, d *Drive, layout PartitionLayout) error {
+	_, err := waitFor(ctx, func() (string, error) {
+		return "", u.syncRepartition(d, layout)
+	})
+	if err == ctx.Err() && err != nil {
+		if cancelErr := u.CancelFormat(d); cancelErr != nil {
+			log.Println("Cannot cancel the format of", d.Path, ":", cancelErr)
+		}
+	}
+	return err
+}
+
+func (u *UDisks2) syncRepartition(d *Drive, layout PartitionLayout) error {
+	log.Println("Repartition", d.Path, "with", layout.PartitionTable, "table and", len(layout.Partitions), "partitions")
+	if err := layout.validate(); err != nil {
+		return err
+	}
+	if err := u.clearDrive(d); err != nil {
+		return err
+	}
+
+	tablePath, err := wholeBlock(d)
+	if err != nil {
+		return err
+	}
+
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	if layout.Erase {
+		options["erase"] = dbus.Variant{"zero"}
+	}
+	if err := u.syncFormat(tablePath, layout.PartitionTable, options); err != nil {
+		return err
+	}
+
+	offset := uint64(partitionAlignment)
+	for _, p := range layout.Partitions {
+		partitionPath, err := u.syncCreatePartition(tablePath, offset, p, layout.PartitionTable)
+		if err != nil {
+			return err
+		}
+		info, err := u.partitionInfo(partitionPath)
+		if err != nil {
+			return err
+		}
+		// UDisks2 may move the partition to keep it aligned
+		offset = alignUp(info.Offset + info.Size)
+
+		if err := u.syncFormat(partitionPath, p.Type, p.formatOptions(layout.PartitionTable).formatOptions()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *UDisks2) syncCreatePartition(o dbus.ObjectPath, offset uint64, p Partition, partitionTable string) (dbus.ObjectPath, error) {
+	partitionType := partitionTypes[partitionTable][p.Type]
+	log.Println("Creating", partitionType, "partition of", p.Size, "bytes at", offset, "on", o)
+	obj := u.conn.Object(dbusName, o)
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	name := ""
+	if partitionTable == PartitionTableGpt {
+		name = p.Name
+	}
+	// a size of 0 makes the partition use all the available space
+	reply, err := call(obj, dbusPartitionTableInterface, "CreatePartition",
+		offset, p.Size, partitionType, name, options)
+	if err != nil {
+		return "", err
+	}
+	var partitionPath dbus.ObjectPath
+	if err := reply.Args(&partitionPath); err != nil {
+		return "", err
+	}
+	return partitionPath, nil
+}
+
+// partitionInfo reads the properties of the partition.
+func (u *UDisks2) partitionInfo(o dbus.ObjectPath) (*PartitionInfo, error) {
+	obj := u.conn.Object(dbusName, o)
+	reply, err := call(obj, dbusPropertiesInterface, "GetAll", dbusPartitionInterface)
+	if err != nil {
+		return nil, err
+	}
+	props := make(VariantMap)
+	if err := reply.Args(&props); err != nil {
+		return nil, err
+	}
+	return InterfacesAndProperties{dbusPartitionInterface: props}.PartitionInfo()
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	. "launchpad.net/gocheck"
+)
+
+type PartitionLayoutTestSuite struct{}
+
+var _ = Suite(&PartitionLayoutTestSuite{})
+
+// testLayout is a data partition followed by swap using the rest of the card.
+var testLayout = PartitionLayout{
+	PartitionTable: PartitionTableDos,
+	Partitions: []Partition{
+		{Size: 4 * 1024 * 1024 * 1024, Type: FilesystemExt4, Label: "data"},
+		{Type: FilesystemSwap},
+	},
+}
+
+func (s *PartitionLayoutTestSuite) TestValidate(c *C) {
+	c.Assert(testLayout.validate(), IsNil)
+
+	gpt := testLayout
+	gpt.PartitionTable = PartitionTableGpt
+	c.Assert(gpt.validate(), IsNil)
+}
+
+func (s *PartitionLayoutTestSuite) TestValidateUnsupportedPartitionTable(c *C) {
+	layout := testLayout
+	layout.PartitionTable = ""
+	c.Assert(layout.validate(), Equals, ErrUnsupportedPartitionTable)
+	layout.PartitionTable = "apm"
+	c.Assert(layout.validate(), Equals, ErrUnsupportedPartitionTable)
+}
+
+func (s *PartitionLayoutTestSuite) TestValidateNoPartitions(c *C) {
+	layout := PartitionLayout{PartitionTable: PartitionTableGpt}
+	c.Assert(layout.validate(), Equals, ErrNoPartitions)
+}
+
+func (s *PartitionLayoutTestSuite) TestValidateTooManyPartitions(c *C) {
+	layout := PartitionLayout{PartitionTable: PartitionTableDos}
+	for i := 0; i < 5; i++ {
+		layout.Partitions = append(layout.Partitions, Partition{Size: 1024 * 1024, Type: FilesystemVfat})
+	}
+	c.Assert(layout.validate(), Equals, ErrTooManyPartitions)
+
+	layout.PartitionTable = PartitionTableGpt
+	c.Assert(layout.validate(), IsNil)
+}
+
+func (s *PartitionLayoutTestSuite) TestValidateRemainingSpaceNotLast(c *C) {
+	layout := PartitionLayout{
+		PartitionTable: PartitionTableGpt,
+		Partitions:     []Partition{{Type: FilesystemExt4}, {Size: 1024 * 1024, Type: FilesystemSwap}},
+	}
+	c.Assert(layout.validate(), Equals, ErrInvalidPartitionSize)
+}
+
+func (s *PartitionLayoutTestSuite) TestValidatePartitions(c *C) {
+	layout := PartitionLayout{
+		PartitionTable: PartitionTableDos,
+		Partitions:     []Partition{{Type: "btrfs"}},
+	}
+	c.Assert(layout.validate(), Equals, ErrUnsupportedFilesystem)
+
+	layout.Partitions = []Partition{{Type: FilesystemVfat, Label: "A LABEL TOO LONG"}}
+	c.Assert(layout.validate(), Equals, ErrInvalidLabel)
+}
+
+func (s *PartitionLayoutTestSuite) TestAlignUp(c *C) {
+	c.Assert(alignUp(0), Equals, uint64(0))
+	c.Assert(alignUp(1), Equals, uint64(partitionAlignment))
+	c.Assert(alignUp(partitionAlignment), Equals, uint64(partitionAlignment))
+	c.Assert(alignUp(3*partitionAlignment+512), Equals, uint64(4*partitionAlignment))
+}
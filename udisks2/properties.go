@@ -22,88 +22,103 @@ package udisks2
 
 import (
 	"log"
-	"reflect"
 
 	"launchpad.net/go-dbus/v1"
 )
 
 const (
-	formatErase           = "format-erase"
-	formateMkfs           = "format-mkfs"
-	unmountFs             = "filesystem-unmount"
-	mountFs               = "filesystem-mount"
-	mountPointsProperty   = "MountPoints"
-	uuidProperty          = "UUID"
-	tableProperty         = "Table"
-	partitionableProperty = "HintPartitionable"
-	operationProperty     = "Operation"
-	objectsProperty       = "Objects"
+	formatErase             = "format-erase"
+	formateMkfs             = "format-mkfs"
+	unmountFs               = "filesystem-unmount"
+	mountFs                 = "filesystem-mount"
+	mountPointsProperty     = "MountPoints"
+	uuidProperty            = "UUID"
+	tableProperty           = "Table"
+	partitionableProperty   = "HintPartitionable"
+	operationProperty       = "Operation"
+	objectsProperty         = "Objects"
+	progressProperty        = "Progress"
+	progressValidProperty   = "ProgressValid"
+	rateProperty            = "Rate"
+	bytesProperty           = "Bytes"
+	expectedEndProperty     = "ExpectedEndTime"
+	cancelableProperty      = "Cancelable"
+	cleartextDeviceProperty = "CleartextDevice"
 )
 
 type VariantMap map[string]dbus.Variant
 type InterfacesAndProperties map[string]VariantMap
 
-func (i InterfacesAndProperties) isMounted() bool {
-	propFS, ok := i[dbusFilesystemInterface]
-	if !ok {
-		return false
-	}
-	mountpointsVariant, ok := propFS[mountPointsProperty]
-	if !ok {
-		return false
+// copy returns a copy of the properties that can be modified without affecting them.
+func (i InterfacesAndProperties) copy() InterfacesAndProperties {
+	c := make(InterfacesAndProperties, len(i))
+	for inter, props := range i {
+		c[inter] = make(VariantMap, len(props))
+		for name, value := range props {
+			c[inter][name] = value
+		}
 	}
-	if reflect.TypeOf(mountpointsVariant.Value).Kind() != reflect.Slice {
+	return c
+}
+
+func (i InterfacesAndProperties) isMounted() bool {
+	fs, err := i.FilesystemInfo()
+	if err != nil {
 		return false
 	}
-	mountpoints := reflect.ValueOf(mountpointsVariant.Value).Len()
-	log.Println("Mount points found:", mountpoints)
+	log.Println("Mount points found:", len(fs.MountPoints))
 
-	return mountpoints > 0
+	return len(fs.MountPoints) > 0
 }
 
 func (i InterfacesAndProperties) hasPartition() bool {
-	prop, ok := i[dbusPartitionInterface]
-	if !ok {
+	partition, err := i.PartitionInfo()
+	if err != nil {
 		return false
 	}
 	// check if a couple of properties exist
-	if _, ok := prop[uuidProperty]; !ok {
-		return false
-	}
-	if _, ok := prop[tableProperty]; !ok {
-		return false
-	}
-	return true
+	return partition.UUID != "" && partition.Table != ""
 }
 
 func (i InterfacesAndProperties) isPartitionable() bool {
-	prop, ok := i[dbusBlockInterface]
-	if !ok {
-		return false
-	}
-	partitionableHintVariant, ok := prop[partitionableProperty]
-	if !ok {
+	block, err := i.BlockInfo()
+	if err != nil {
 		return false
 	}
-	if reflect.TypeOf(partitionableHintVariant.Value).Kind() != reflect.Bool {
+	return block.HintPartitionable
+}
+
+// hintSystem tells if the block device is a system device. HintSystem is read on its own
+// so that other malformed properties do not hide it, and it is taken as set when it
+// cannot be decoded.
+func (i InterfacesAndProperties) hintSystem() bool {
+	d, err := i.decoder(dbusBlockInterface)
+	if err != nil {
 		return false
 	}
-	return reflect.ValueOf(partitionableHintVariant.Value).Bool()
+	system := d.bool("HintSystem")
+	return system || d.err != nil
 }
 
 func (i InterfacesAndProperties) jobOperation() string {
-	prop, ok := i[dbusJobInterface]
-	if !ok {
+	job, err := i.JobInfo()
+	if err != nil {
 		return ""
 	}
-	operationVariant, ok := prop[operationProperty]
-	if !ok {
-		return ""
+	return job.Operation
+}
+
+// jobObjects returns the paths of the objects the job is acting on.
+func (i InterfacesAndProperties) jobObjects() []string {
+	job, err := i.JobInfo()
+	if err != nil {
+		return nil
 	}
-	if reflect.TypeOf(operationVariant.Value).Kind() != reflect.String {
-		return ""
+	paths := make([]string, len(job.Objects))
+	for j := range job.Objects {
+		paths[j] = string(job.Objects[j])
 	}
-	return reflect.ValueOf(operationVariant.Value).String()
+	return paths
 }
 
 func (i InterfacesAndProperties) isEraseFormatJob() bool {
@@ -124,31 +139,24 @@ func (i InterfacesAndProperties) isMountJob() bool {
 }
 
 func (i InterfacesAndProperties) getFormattedPaths() []string {
-	var objectPaths []string
-	prop, ok := i[dbusJobInterface]
-	if !ok {
-		return objectPaths
-	}
-	operationVariant, ok := prop[operationProperty]
-	if !ok {
-		return objectPaths
+	operation := i.jobOperation()
+	if operation == formateMkfs || operation == unmountFs || operation == mountFs {
+		return i.jobObjects()
 	}
+	return nil
+}
 
-	operationStr := reflect.ValueOf(operationVariant.Value).String()
-	if operationStr == formateMkfs || operationStr == unmountFs || operationStr == mountFs {
-		objs, ok := prop[objectsProperty]
-		if ok {
-			objsVal := reflect.ValueOf(objs.Value)
-			length := objsVal.Len()
-			objectPaths = make([]string, length, length)
-			for i := 0; i < length; i++ {
-				objectPaths[i] = objsVal.Index(i).Elem().String()
-			}
-			return objectPaths
-		}
+func (i InterfacesAndProperties) isLocked() bool {
+	encrypted, err := i.EncryptedInfo()
+	if err != nil {
+		return false
 	}
+	return !encrypted.Unlocked()
+}
 
-	return objectPaths
+func (i InterfacesAndProperties) isLoop() bool {
+	_, ok := i[dbusLoopInterface]
+	return ok
 }
 
 func (i InterfacesAndProperties) isFilesystem() bool {
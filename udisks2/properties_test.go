@@ -217,3 +217,35 @@ func (s *InterfacesAndPropertiesTestSuite) TestIsFileSystem(c *C) {
 	s.properties[dbusFilesystemInterface] = make(map[string]dbus.Variant)
 	c.Assert(s.properties.isFilesystem(), Equals, true)
 }
+
+func (s *InterfacesAndPropertiesTestSuite) TestJobObjectsMissingInterface(c *C) {
+	c.Assert(len(s.properties.jobObjects()), Equals, 0)
+}
+
+func (s *InterfacesAndPropertiesTestSuite) TestJobObjects(c *C) {
+	objsPaths := make([]interface{}, 2, 2)
+	objsPaths[0] = dbus.ObjectPath("/path/to/erased/fs/1")
+	objsPaths[1] = "/path/to/erased/fs/2"
+
+	s.properties[dbusJobInterface] = make(map[string]dbus.Variant)
+	s.properties[dbusJobInterface]["Operation"] = dbus.Variant{"format-erase"}
+	s.properties[dbusJobInterface]["Objects"] = dbus.Variant{objsPaths}
+
+	paths := s.properties.jobObjects()
+	c.Assert(paths, DeepEquals, []string{"/path/to/erased/fs/1", "/path/to/erased/fs/2"})
+}
+
+func (s *InterfacesAndPropertiesTestSuite) TestHintSystem(c *C) {
+	s.properties[dbusBlockInterface] = make(map[string]dbus.Variant)
+	c.Assert(s.properties.hintSystem(), Equals, false)
+	s.properties[dbusBlockInterface]["HintSystem"] = dbus.Variant{true}
+	// another malformed property does not hide the hint
+	s.properties[dbusBlockInterface]["Size"] = dbus.Variant{"large"}
+	c.Assert(s.properties.hintSystem(), Equals, true)
+}
+
+func (s *InterfacesAndPropertiesTestSuite) TestHintSystemMalformed(c *C) {
+	s.properties[dbusBlockInterface] = make(map[string]dbus.Variant)
+	s.properties[dbusBlockInterface]["HintSystem"] = dbus.Variant{"false"}
+	c.Assert(s.properties.hintSystem(), Equals, true)
+}
@@ -21,12 +21,11 @@
 package udisks2
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path"
-	"reflect"
-	"runtime"
 	"sort"
 	"strings"
 	"sync"
@@ -47,202 +46,721 @@ const (
 	dbusPartitionInterface      = "org.freedesktop.UDisks2.Partition"
 	dbusPartitionTableInterface = "org.freedesktop.UDisks2.PartitionTable"
 	dbusJobInterface            = "org.freedesktop.UDisks2.Job"
+	dbusEncryptedInterface      = "org.freedesktop.UDisks2.Encrypted"
+	dbusLoopInterface           = "org.freedesktop.UDisks2.Loop"
+	dbusManagerInterface        = "org.freedesktop.UDisks2.Manager"
+	dbusManagerObject           = "/org/freedesktop/UDisks2/Manager"
 	dbusPropertiesInterface     = "org.freedesktop.DBus.Properties"
 	dbusAddedSignal             = "InterfacesAdded"
 	dbusRemovedSignal           = "InterfacesRemoved"
+	dbusPropertiesChangedSignal = "PropertiesChanged"
 )
 
-var ErrUnhandledFileSystem = errors.New("unhandled filesystem")
+var (
+	ErrUnhandledFileSystem = errors.New("unhandled filesystem")
+	ErrCancelled           = errors.New("operation cancelled")
+	ErrNotCancelable       = errors.New("job cannot be cancelled")
+	ErrNoFormatJob         = errors.New("no ongoing format job")
+	ErrNotMounted          = errors.New("drive is not mounted")
+	ErrBusy                = errors.New("device is busy")
+	ErrNotAuthorized       = errors.New("not authorized")
+	ErrAlreadyMounted      = errors.New("device is already mounted")
+	ErrNotSupported        = errors.New("operation not supported")
+	ErrTimedOut            = errors.New("operation timed out")
+	ErrCannotPowerOff      = errors.New("drive cannot be powered off")
+	ErrNotEjectable        = errors.New("drive media cannot be ejected")
+)
 
 type Drive struct {
 	Path         dbus.ObjectPath
 	blockDevices map[dbus.ObjectPath]InterfacesAndProperties
 	driveInfo    InterfacesAndProperties
+	info         *DriveInfo
 	Mounted      bool
 }
 
+// BlockDevice holds the decoded properties of a block device, Filesystem, Partition and
+// Encrypted are nil when the block device does not implement the matching interface.
+type BlockDevice struct {
+	Path       dbus.ObjectPath
+	Block      BlockInfo
+	Filesystem *FilesystemInfo
+	Partition  *PartitionInfo
+	Encrypted  *EncryptedInfo
+}
+
 type MountEvent struct {
 	Path       dbus.ObjectPath
 	Mountpoint string
 }
 
+// ChangeEvent is emitted when the properties of a drive or of one of its block devices
+// change.
+type ChangeEvent struct {
+	Drive      dbus.ObjectPath
+	Path       dbus.ObjectPath
+	Interface  string
+	Properties []string
+}
+
 type driveMap map[dbus.ObjectPath]*Drive
 
 type mountpointMap map[dbus.ObjectPath]string
 
 type UDisks2 struct {
-	conn            *dbus.Connection
-	validFS         sort.StringSlice
-	blockAdded      chan *Event
-	driveAdded      *dbus.SignalWatch
-	mountRemoved    chan string
-	blockError      chan error
-	driveRemoved    *dbus.SignalWatch
-	blockDevice     chan bool
-	drives          driveMap
-	mountpoints     mountpointMap
-	mapLock         sync.Mutex
-	startLock       sync.Mutex
-	dispatcher      *dispatcher
-	jobs            *jobManager
-	pendingMounts   []string
-	formatCompleted chan *Event
-	formatErrors    chan error
-	umountCompleted chan string
-	unmountErrors   chan error
-	mountCompleted  chan MountEvent
-	mountErrors     chan error
+	conn           *dbus.Connection
+	validFS        sort.StringSlice
+	drives         driveMap
+	mountpoints    mountpointMap
+	mapLock        sync.Mutex
+	startLock      sync.Mutex
+	dispatcher     *dispatcher
+	jobs           *jobManager
+	pendingMounts  []string
+	mountPolicy    MountPolicy
+	automountRules AutomountRules
+	backups        map[dbus.ObjectPath]context.CancelFunc
+	backupLock     sync.Mutex
+	formats        map[dbus.ObjectPath]bool
+	formatLock     sync.Mutex
+	bus            *eventBus
+	done           chan struct{}
+	wg             sync.WaitGroup
+	closeOnce      sync.Once
 }
 
 func NewStorageWatcher(conn *dbus.Connection, filesystems ...string) (u *UDisks2) {
+	// the filesystems are looked up with a binary search
+	validFS := append(sort.StringSlice(nil), filesystems...)
+	validFS.Sort()
 	u = &UDisks2{
-		conn:          conn,
-		validFS:       sort.StringSlice(filesystems),
-		drives:        make(driveMap),
-		mountpoints:   make(mountpointMap),
-		pendingMounts: make([]string, 0, 0),
+		conn:           conn,
+		validFS:        validFS,
+		drives:         make(driveMap),
+		mountpoints:    make(mountpointMap),
+		pendingMounts:  make([]string, 0, 0),
+		mountPolicy:    DefaultMountPolicy,
+		automountRules: DefaultAutomountRules,
+		backups:        make(map[dbus.ObjectPath]context.CancelFunc),
+		formats:        make(map[dbus.ObjectPath]bool),
+		bus:            newEventBus(),
+		done:           make(chan struct{}),
 	}
-	runtime.SetFinalizer(u, cleanDriveWatch)
 	return u
 }
 
-func (u *UDisks2) SubscribeAddEvents() (<-chan *Event, <-chan error) {
-	u.blockAdded = make(chan *Event)
-	u.blockError = make(chan error)
-	return u.blockAdded, u.blockError
+// All the Subscribe methods register a new subscriber, therefore several subscribers can
+// receive the same events. The optional SubscribeOptions set the buffering of the returned
+// channels and what happens when they are full, DefaultSubscribeOptions are used otherwise.
+
+func (u *UDisks2) SubscribeAddEvents(opts ...SubscribeOptions) (<-chan *Event, <-chan error) {
+	o := subscribeOptions(opts)
+	blockAdded := make(chan *Event, o.Buffer)
+	blockError := make(chan error, o.Buffer)
+	u.bus.subscribe(topicBlockAdded, blockAdded, o)
+	u.bus.subscribe(topicBlockError, blockError, o)
+	return blockAdded, blockError
+}
+
+func (u *UDisks2) SubscribeRemoveEvents(opts ...SubscribeOptions) <-chan string {
+	o := subscribeOptions(opts)
+	mountRemoved := make(chan string, o.Buffer)
+	u.bus.subscribe(topicMountRemoved, mountRemoved, o)
+	return mountRemoved
+}
+
+func (u *UDisks2) SubscribeBlockDeviceEvents(opts ...SubscribeOptions) <-chan bool {
+	o := subscribeOptions(opts)
+	blockDevice := make(chan bool, o.Buffer)
+	u.bus.subscribe(topicBlockDevice, blockDevice, o)
+	return blockDevice
+}
+
+func (u *UDisks2) SubscribeFormatEvents(opts ...SubscribeOptions) (<-chan *Event, <-chan error) {
+	o := subscribeOptions(opts)
+	formatCompleted := make(chan *Event, o.Buffer)
+	formatErrors := make(chan error, o.Buffer)
+	u.bus.subscribe(topicFormatCompleted, formatCompleted, o)
+	u.bus.subscribe(topicFormatErrors, formatErrors, o)
+	return formatCompleted, formatErrors
 }
 
-func (u *UDisks2) SubscribeRemoveEvents() <-chan string {
-	u.mountRemoved = make(chan string)
-	return u.mountRemoved
+func (u *UDisks2) SubscribeUnmountEvents(opts ...SubscribeOptions) (<-chan string, <-chan error) {
+	o := subscribeOptions(opts)
+	umountCompleted := make(chan string, o.Buffer)
+	unmountErrors := make(chan error, o.Buffer)
+	u.bus.subscribe(topicUnmountCompleted, umountCompleted, o)
+	u.bus.subscribe(topicUnmountErrors, unmountErrors, o)
+	return umountCompleted, unmountErrors
 }
 
-func (u *UDisks2) SubscribeBlockDeviceEvents() <-chan bool {
-	u.blockDevice = make(chan bool)
-	return u.blockDevice
+func (u *UDisks2) SubscribeMountEvents(opts ...SubscribeOptions) (<-chan MountEvent, <-chan error) {
+	o := subscribeOptions(opts)
+	mountCompleted := make(chan MountEvent, o.Buffer)
+	mountErrors := make(chan error, o.Buffer)
+	u.bus.subscribe(topicMountCompleted, mountCompleted, o)
+	u.bus.subscribe(topicMountErrors, mountErrors, o)
+	return mountCompleted, mountErrors
 }
 
-func (u *UDisks2) SubscribeFormatEvents() (<-chan *Event, <-chan error) {
-	u.formatCompleted = make(chan *Event)
-	u.formatErrors = make(chan error)
-	return u.formatCompleted, u.formatErrors
+// SubscribeJobProgress returns a channel where the progress of the ongoing UDisks2 jobs is
+// reported every time UDisks2 updates it.
+func (u *UDisks2) SubscribeJobProgress(opts ...SubscribeOptions) <-chan JobProgress {
+	o := subscribeOptions(opts)
+	jobProgress := make(chan JobProgress, o.Buffer)
+	u.bus.subscribe(topicJobProgress, jobProgress, o)
+	return jobProgress
 }
 
-func (u *UDisks2) SubscribeUnmountEvents() (<-chan string, <-chan error) {
-	u.umountCompleted = make(chan string)
-	u.unmountErrors = make(chan error)
-	return u.umountCompleted, u.unmountErrors
+// SubscribeChangeEvents returns a channel where an event is sent every time the properties
+// of a known drive or of its block devices change, for example when another process
+// mounts one of its filesystems.
+func (u *UDisks2) SubscribeChangeEvents(opts ...SubscribeOptions) <-chan ChangeEvent {
+	o := subscribeOptions(opts)
+	driveChanged := make(chan ChangeEvent, o.Buffer)
+	u.bus.subscribe(topicDriveChanged, driveChanged, o)
+	return driveChanged
 }
 
-func (u *UDisks2) SubscribeMountEvents() (<-chan MountEvent, <-chan error) {
-	u.mountCompleted = make(chan MountEvent)
-	u.mountErrors = make(chan error)
-	return u.mountCompleted, u.mountErrors
+// SubscribeReadyToRemoveEvents returns a channel where the path of a drive is sent once
+// SafeRemove is done with it and the drive can be unplugged, power off errors are sent
+// to the second channel.
+func (u *UDisks2) SubscribeReadyToRemoveEvents(opts ...SubscribeOptions) (<-chan dbus.ObjectPath, <-chan error) {
+	o := subscribeOptions(opts)
+	readyToRemove := make(chan dbus.ObjectPath, o.Buffer)
+	powerOffErrors := make(chan error, o.Buffer)
+	u.bus.subscribe(topicReadyToRemove, readyToRemove, o)
+	u.bus.subscribe(topicPowerOffErrors, powerOffErrors, o)
+	return readyToRemove, powerOffErrors
+}
+
+// SubscribeDetachedEvents returns a channel where the path of a drive is sent when
+// SafeRemove lazily unmounted its filesystems, the drive must not be unplugged until the
+// processes using them are closed.
+func (u *UDisks2) SubscribeDetachedEvents(opts ...SubscribeOptions) <-chan dbus.ObjectPath {
+	o := subscribeOptions(opts)
+	detached := make(chan dbus.ObjectPath, o.Buffer)
+	u.bus.subscribe(topicDetached, detached, o)
+	return detached
+}
+
+// SubscribeUnlockEvents returns a channel where the locked encrypted block devices of
+// removable drives are sent, they have to be unlocked with Unlock before being mounted.
+func (u *UDisks2) SubscribeUnlockEvents(opts ...SubscribeOptions) <-chan *Event {
+	o := subscribeOptions(opts)
+	unlockRequired := make(chan *Event, o.Buffer)
+	u.bus.subscribe(topicUnlockRequired, unlockRequired, o)
+	return unlockRequired
+}
+
+// Unsubscribe stops the delivery of events to a channel returned by one of the Subscribe
+// methods and closes it. It returns false if the channel was not subscribed.
+func (u *UDisks2) Unsubscribe(ch interface{}) bool {
+	return u.bus.unsubscribe(ch)
 }
 
 func (u *UDisks2) Mount(s *Event) {
 	go func() {
-		var mountpoint string
-		obj := u.conn.Object(dbusName, s.Path)
-		options := make(VariantMap)
-		options["auth.no_user_interaction"] = dbus.Variant{true}
-		reply, err := obj.Call(dbusFilesystemInterface, "Mount", options)
+		mountpoint, err := u.syncMount(s.Path)
 		if err != nil {
-			u.mountErrors <- err
-		}
-		if err := reply.Args(&mountpoint); err != nil {
-			u.mountErrors <- err
+			u.bus.publish(topicMountErrors, err)
+			return
 		}
 
 		log.Println("Mounth path for '", s.Path, "' set to be", mountpoint)
 	}()
 }
 
-func (u *UDisks2) Unmount(d *Drive) {
+// MountSync mounts the filesystem with the given path and returns its mountpoint once
+// UDisks2 is done mounting it.
+func (u *UDisks2) MountSync(ctx context.Context, p dbus.ObjectPath) (string, error) {
+	return waitFor(ctx, func() (string, error) {
+		return u.syncMount(p)
+	})
+}
+
+func (u *UDisks2) syncMount(o dbus.ObjectPath) (string, error) {
+	var mountpoint string
+	obj := u.conn.Object(dbusName, o)
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	if mountOptions := u.mountOptions(o); mountOptions != "" {
+		log.Println("Mounting", o, "with options", mountOptions)
+		options["options"] = dbus.Variant{mountOptions}
+	}
+	reply, err := call(obj, dbusFilesystemInterface, "Mount", options)
+	if err != nil {
+		return "", err
+	}
+	if err := reply.Args(&mountpoint); err != nil {
+		return "", err
+	}
+	return mountpoint, nil
+}
+
+// Unmount unmounts the filesystems of the drive, the mode tells what to do when they
+// are busy.
+func (u *UDisks2) Unmount(d *Drive, mode UnmountMode) {
 	if d.Mounted {
 		for blockPath, _ := range d.blockDevices {
-			u.umount(blockPath)
+			u.umount(blockPath, mode)
 		}
 	} else {
 		log.Println("Block is not mounted", d)
-		u.unmountErrors <- fmt.Errorf("Drive is not mounted ", d)
+		u.bus.publish(topicUnmountErrors, ErrNotMounted)
+	}
+}
+
+// UnmountSync unmounts all the mounted filesystems of the drive and returns once UDisks2
+// is done unmounting them. ErrDetached is returned once all of them are unmounted if any
+// had to be detached while in use.
+func (u *UDisks2) UnmountSync(ctx context.Context, d *Drive, mode UnmountMode) error {
+	if !d.Mounted {
+		return ErrNotMounted
 	}
+	_, err := waitFor(ctx, func() (string, error) {
+		detached := false
+		for blockPath, block := range d.blockDevices {
+			if !block.isMounted() {
+				continue
+			}
+			err := u.syncUmount(blockPath, mode)
+			if err == ErrDetached {
+				detached = true
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		if detached {
+			return "", ErrDetached
+		}
+		return "", nil
+	})
+	return err
 }
 
-func (u *UDisks2) syncUmount(o dbus.ObjectPath) error {
+func (u *UDisks2) syncUmount(o dbus.ObjectPath, mode UnmountMode) error {
 	log.Println("Unmounting", o)
 	obj := u.conn.Object(dbusName, o)
+	err := retryUnmount(mode, func(force bool) error {
+		options := make(VariantMap)
+		options["auth.no_user_interaction"] = dbus.Variant{true}
+		if force {
+			options["force"] = dbus.Variant{true}
+		}
+		_, err := call(obj, dbusFilesystemInterface, "Unmount", options)
+		return err
+	})
+	if err == ErrBusy {
+		return u.busyError(o)
+	}
+	return err
+}
+
+func (u *UDisks2) umount(o dbus.ObjectPath, mode UnmountMode) {
+	go func() {
+		err := u.syncUmount(o, mode)
+		if err != nil {
+			u.bus.publish(topicUnmountErrors, err)
+		}
+	}()
+}
+
+// PowerOff powers off the drive so that it can be safely unplugged, the filesystems of the
+// drive have to be unmounted beforehand.
+func (u *UDisks2) PowerOff(d *Drive) error {
+	info := d.Info()
+	if !info.CanPowerOff {
+		return ErrCannotPowerOff
+	}
+	log.Println("Powering off", d.Path)
+	obj := u.conn.Object(dbusName, d.Path)
 	options := make(VariantMap)
 	options["auth.no_user_interaction"] = dbus.Variant{true}
-	_, err := obj.Call(dbusFilesystemInterface, "Unmount", options)
+	_, err := call(obj, dbusDriveInterface, "PowerOff", options)
 	return err
 }
 
-func (u *UDisks2) umount(o dbus.ObjectPath) {
+// SafeRemove unmounts all the filesystems of the drive and powers it off when possible.
+// Unmount errors are reported with the unmount events, otherwise a ready to remove event
+// is sent once the drive can be unplugged. A drive whose filesystems were lazily unmounted
+// is still written to, it is not powered off and a detached event is sent instead.
+func (u *UDisks2) SafeRemove(d *Drive, mode UnmountMode) {
 	go func() {
-		err := u.syncUmount(o)
-		if err != nil {
-			u.unmountErrors <- err
+		if err := u.unmountAll(d, mode); err == ErrDetached {
+			log.Println("Drive", d.Path, "was detached while still in use")
+			u.bus.publish(topicDetached, d.Path)
+			return
+		} else if err != nil {
+			u.bus.publish(topicUnmountErrors, err)
+			return
+		}
+		if err := u.lockAll(d); err != nil {
+			u.bus.publish(topicUnmountErrors, err)
+			return
+		}
+
+		// the data is already flushed so the drive is ready even if it stays powered
+		if err := u.PowerOff(d); err == ErrCannotPowerOff {
+			log.Println("Drive", d.Path, "cannot be powered off")
+		} else if err != nil {
+			log.Println("Error while powering off", d.Path, ":", err)
+			u.bus.publish(topicPowerOffErrors, err)
 		}
+		u.bus.publish(topicReadyToRemove, d.Path)
 	}()
 }
 
-func (u *UDisks2) syncFormat(o dbus.ObjectPath) error {
+// Eject unmounts the filesystems of the drive and ejects its media.
+func (u *UDisks2) Eject(d *Drive) error {
+	if !d.Ejectable() {
+		return ErrNotEjectable
+	}
+	if err := u.unmountAll(d, DefaultUnmountMode); err != nil {
+		return err
+	}
+	log.Println("Ejecting", d.Path)
+	obj := u.conn.Object(dbusName, d.Path)
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	_, err := call(obj, dbusDriveInterface, "Eject", options)
+	return err
+}
+
+// unmountAll does a sync unmount of the mounted filesystems of the drive, ErrDetached is
+// returned once all of them are unmounted if any was lazily unmounted.
+func (u *UDisks2) unmountAll(d *Drive, mode UnmountMode) error {
+	detached := false
+	for blockPath, _ := range d.blockDevices {
+		if len(u.mountpointsForPath(blockPath)) == 0 {
+			continue
+		}
+		err := u.syncUmount(blockPath, mode)
+		if err == ErrDetached {
+			detached = true
+			continue
+		}
+		if err != nil {
+			log.Println("Error while unmounting", blockPath, ":", err)
+			return err
+		}
+	}
+	if detached {
+		return ErrDetached
+	}
+	return nil
+}
+
+// Unlock unlocks the encrypted block device with the passphrase and returns the path of
+// the cleartext device, which is then mounted like any other block device.
+func (u *UDisks2) Unlock(p dbus.ObjectPath, passphrase string) (dbus.ObjectPath, error) {
+	log.Println("Unlocking", p)
+	var cleartext dbus.ObjectPath
+	obj := u.conn.Object(dbusName, p)
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	reply, err := call(obj, dbusEncryptedInterface, "Unlock", passphrase, options)
+	if err != nil {
+		return "", err
+	}
+	if err := reply.Args(&cleartext); err != nil {
+		return "", err
+	}
+	return cleartext, nil
+}
+
+// Lock unmounts the cleartext device of the encrypted block device and locks it.
+func (u *UDisks2) Lock(p dbus.ObjectPath) error {
+	obj := u.conn.Object(dbusName, p)
+	reply, err := call(obj, dbusPropertiesInterface, "Get", dbusEncryptedInterface, cleartextDeviceProperty)
+	if err != nil {
+		return err
+	}
+	cleartextVar := dbus.Variant{}
+	if err := reply.Args(&cleartextVar); err != nil {
+		return err
+	}
+	props := InterfacesAndProperties{dbusEncryptedInterface: VariantMap{cleartextDeviceProperty: cleartextVar}}
+	encrypted, err := props.EncryptedInfo()
+	if err != nil {
+		return err
+	}
+	if encrypted.Unlocked() && len(u.mountpointsForPath(encrypted.CleartextDevice)) > 0 {
+		if err := u.syncUmount(encrypted.CleartextDevice, DefaultUnmountMode); err != nil {
+			return err
+		}
+	}
+
+	log.Println("Locking", p)
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	_, err = call(obj, dbusEncryptedInterface, "Lock", options)
+	return err
+}
+
+// lockAll locks the unlocked encrypted block devices of the drive.
+func (u *UDisks2) lockAll(d *Drive) error {
+	for blockPath, block := range d.blockDevices {
+		encrypted, err := block.EncryptedInfo()
+		if err != nil || !encrypted.Unlocked() {
+			continue
+		}
+		if err := u.Lock(blockPath); err != nil {
+			log.Println("Error while locking", blockPath, ":", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *UDisks2) syncFormat(o dbus.ObjectPath, fsType string, options VariantMap) error {
 	// perform sync call to format the device
-	log.Println("Formatting", o)
+	log.Println("Formatting", o, "with", fsType)
+	obj := u.conn.Object(dbusName, o)
+	_, err := call(obj, dbusBlockInterface, "Format", fsType, options)
+	return err
+}
+
+func (u *UDisks2) syncCreatePartitionAndFormat(o dbus.ObjectPath, opts FormatOptions) error {
+	log.Println("Creating", opts.partitionType(), "partition on", o)
 	obj := u.conn.Object(dbusName, o)
 	options := make(VariantMap)
 	options["auth.no_user_interaction"] = dbus.Variant{true}
-	_, err := obj.Call(dbusBlockInterface, "Format", "vfat", options)
+	// an offset and size of 0 make the partition use all the available space
+	_, err := call(obj, dbusPartitionTableInterface, "CreatePartitionAndFormat",
+		uint64(0), uint64(0), opts.partitionType(), "", options, opts.Type, opts.formatOptions())
 	return err
 }
 
-func (u *UDisks2) Format(d *Drive) {
+func (u *UDisks2) Format(d *Drive, opts FormatOptions) {
 	go func() {
-		log.Println("Format", d)
-		// do a sync call to unmount
-		for blockPath, _ := range d.blockDevices {
-			mps := u.mountpointsForPath(blockPath)
-			if len(mps) > 0 {
-				log.Println("Unmounting", blockPath)
-				err := u.syncUmount(blockPath)
-				if err != nil {
-					log.Println("Error while doing a pre-format unmount:", err)
-					u.formatErrors <- err
-					return
-				}
-			}
+		if err := u.syncFormatDrive(d, opts); err != nil {
+			u.bus.publish(topicFormatErrors, err)
 		}
+		// no, we do not send a success because it should be done ONLY when we get a format job done
+		// event from the dispatcher.
+	}()
+}
 
-		// delete all the partitions
-		for blockPath, block := range d.blockDevices {
-			if block.hasPartition() {
-				if err := u.deletePartition(blockPath); err != nil {
-					log.Println("Issues while deleting partition on", blockPath, ":", err)
-					u.formatErrors <- err
-					return
-				}
-				// delete the block from the map as it shouldn't exist anymore
-				delete(d.blockDevices, blockPath)
-			}
+// FormatSync formats the drive and returns once UDisks2 is done creating the new
+// filesystem. If the context is done before that the format jobs are cancelled.
+func (u *UDisks2) FormatSync(ctx context.Context, d *Drive, opts FormatOptions) error {
+	_, err := waitFor(ctx, func() (string, error) {
+		return "", u.syncFormatDrive(d, opts)
+	})
+	if err == ctx.Err() && err != nil {
+		if cancelErr := u.CancelFormat(d); cancelErr != nil {
+			log.Println("Cannot cancel the format of", d.Path, ":", cancelErr)
 		}
+	}
+	return err
+}
 
-		// format the blocks with PartitionTable
-		for blockPath, block := range d.blockDevices {
-			if !block.isPartitionable() {
-				continue
-			}
+func (u *UDisks2) syncFormatDrive(d *Drive, opts FormatOptions) error {
+	log.Println("Format", d, "with", opts)
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	u.formatLock.Lock()
+	u.formats[d.Path] = false
+	u.formatLock.Unlock()
+	defer func() {
+		u.formatLock.Lock()
+		delete(u.formats, d.Path)
+		u.formatLock.Unlock()
+	}()
+
+	if err := u.clearDrive(d); err != nil {
+		return err
+	}
+
+	// format the blocks with PartitionTable
+	for blockPath, block := range d.blockDevices {
+		if !block.isPartitionable() {
+			continue
+		}
+		if u.formatCancelled(d) {
+			return ErrCancelled
+		}
 
+		if opts.PartitionTable == "" {
 			// perform sync call to format the device
-			log.Println("Formatting", blockPath)
-			err := u.syncFormat(blockPath)
+			if err := u.syncFormat(blockPath, opts.Type, opts.formatOptions()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// create the partition table and a single partition holding the filesystem
+		options := make(VariantMap)
+		options["auth.no_user_interaction"] = dbus.Variant{true}
+		if opts.Erase {
+			options["erase"] = dbus.Variant{"zero"}
+		}
+		if err := u.syncFormat(blockPath, opts.PartitionTable, options); err != nil {
+			return err
+		}
+		if u.formatCancelled(d) {
+			return ErrCancelled
+		}
+		// the new partition lies on space that was just erased
+		partitionOpts := opts
+		partitionOpts.Erase = false
+		if err := u.syncCreatePartitionAndFormat(blockPath, partitionOpts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatCancelled tells if CancelFormat was called for the ongoing format of the drive.
+func (u *UDisks2) formatCancelled(d *Drive) bool {
+	u.formatLock.Lock()
+	defer u.formatLock.Unlock()
+	return u.formats[d.Path]
+}
+
+// clearDrive unmounts the filesystems of the drive, locks its encrypted containers and
+// deletes its partitions.
+func (u *UDisks2) clearDrive(d *Drive) error {
+	// do a sync call to unmount
+	for blockPath, _ := range d.blockDevices {
+		mps := u.mountpointsForPath(blockPath)
+		if len(mps) > 0 {
+			log.Println("Unmounting", blockPath)
+			err := u.syncUmount(blockPath, DefaultUnmountMode)
 			if err != nil {
-				u.formatErrors <- err
+				log.Println("Error while doing a pre-format unmount:", err)
+				return err
 			}
 		}
-		// no, we do not send a success because it should be done ONLY when we get a format job done
-		// event from the dispatcher.
+	}
+
+	// encrypted containers cannot be formatted while unlocked
+	if err := u.lockAll(d); err != nil {
+		return err
+	}
+
+	// delete all the partitions
+	for blockPath, block := range d.blockDevices {
+		if block.hasPartition() {
+			if err := u.deletePartition(blockPath); err != nil {
+				log.Println("Issues while deleting partition on", blockPath, ":", err)
+				return err
+			}
+			// delete the block from the map as it shouldn't exist anymore
+			delete(d.blockDevices, blockPath)
+		}
+	}
+	return nil
+}
+
+// waitFor runs f and waits for its result unless the context is done first.
+func waitFor(ctx context.Context, f func() (string, error)) (string, error) {
+	type result struct {
+		value string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := f()
+		done <- result{value, err}
 	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// CancelJob cancels the UDisks2 job with the given path as long as the job can be cancelled.
+func (u *UDisks2) CancelJob(p dbus.ObjectPath) error {
+	log.Println("Cancelling job", p)
+	obj := u.conn.Object(dbusName, p)
+	reply, err := call(obj, dbusPropertiesInterface, "Get", dbusJobInterface, cancelableProperty)
+	if err != nil {
+		return err
+	}
+	cancelable := dbus.Variant{}
+	if err := reply.Args(&cancelable); err != nil {
+		return err
+	}
+	if c, ok := cancelable.Value.(bool); !ok || !c {
+		return ErrNotCancelable
+	}
+
+	options := make(VariantMap)
+	options["auth.no_user_interaction"] = dbus.Variant{true}
+	_, err = call(obj, dbusJobInterface, "Cancel", options)
+	return err
+}
+
+// CancelFormat cancels the ongoing erase and mkfs jobs acting on the block devices of the
+// given drive. The Format call that started them reports ErrCancelled on the format errors
+// channel. A format that has not started its jobs yet stops before starting them.
+func (u *UDisks2) CancelFormat(d *Drive) error {
+	u.formatLock.Lock()
+	_, pending := u.formats[d.Path]
+	if pending {
+		u.formats[d.Path] = true
+	}
+	u.formatLock.Unlock()
+
+	obj := u.conn.Object(dbusName, dbusObject)
+	reply, err := call(obj, dbusObjectManagerInterface, "GetManagedObjects")
+	if err != nil {
+		return err
+	}
+	allObjects := make(map[dbus.ObjectPath]InterfacesAndProperties)
+	if err := reply.Args(&allObjects); err != nil {
+		return err
+	}
+
+	cancelled := false
+	for objectPath, props := range allObjects {
+		if objectPathType(objectPath) != deviceTypeJob {
+			continue
+		}
+		if !props.isEraseFormatJob() && !props.isMkfsFormatJob() {
+			continue
+		}
+		if !u.driveHoldsAny(d, props.jobObjects()) {
+			continue
+		}
+		if err := u.CancelJob(objectPath); err != nil {
+			return err
+		}
+		cancelled = true
+	}
+
+	if !cancelled && !pending {
+		return ErrNoFormatJob
+	}
+	return nil
+}
+
+// driveHoldsAny returns if any of the given object paths is a block device of the drive.
+func (u *UDisks2) driveHoldsAny(d *Drive, paths []string) bool {
+	u.mapLock.Lock()
+	defer u.mapLock.Unlock()
+	// partitions might have been created after the drive was handed out so the current
+	// state of the drive is checked too
+	current, ok := u.drives[d.Path]
+	for _, p := range paths {
+		if _, found := d.blockDevices[dbus.ObjectPath(p)]; found {
+			return true
+		}
+		if ok {
+			if _, found := current.blockDevices[dbus.ObjectPath(p)]; found {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (u *UDisks2) deletePartition(o dbus.ObjectPath) error {
@@ -250,20 +768,16 @@ func (u *UDisks2) deletePartition(o dbus.ObjectPath) error {
 	obj := u.conn.Object(dbusName, o)
 	options := make(VariantMap)
 	options["auth.no_user_interaction"] = dbus.Variant{true}
-	_, err := obj.Call(dbusPartitionInterface, "Delete", options)
+	_, err := call(obj, dbusPartitionInterface, "Delete", options)
 	return err
 }
 
 func (u *UDisks2) mountpointsForPath(p dbus.ObjectPath) []string {
 	var mountpoints []string
 	proxy := u.conn.Object(dbusName, p)
-	reply, err := proxy.Call(dbusPropertiesInterface, "Get", dbusFilesystemInterface, mountPointsProperty)
+	reply, err := call(proxy, dbusPropertiesInterface, "Get", dbusFilesystemInterface, mountPointsProperty)
 	if err != nil {
-		log.Println("Error getting mount points")
-		return mountpoints
-	}
-	if reply.Type == dbus.TypeError {
-		log.Println("dbus error: %", reply.ErrorName)
+		log.Println("Error getting mount points:", err)
 		return mountpoints
 	}
 
@@ -273,44 +787,59 @@ func (u *UDisks2) mountpointsForPath(p dbus.ObjectPath) []string {
 		return mountpoints
 	}
 
-	mountPointsVal := reflect.ValueOf(mountpointsVar.Value)
-	length := mountPointsVal.Len()
-	mountpoints = make([]string, length, length)
-	for i := 0; i < length; i++ {
-		array := reflect.ValueOf(mountPointsVal.Index(i).Interface())
-		arrayLenght := array.Len()
-		byteArray := make([]byte, arrayLenght, arrayLenght)
-		for j := 0; j < arrayLenght; j++ {
-			byteArray[j] = array.Index(j).Interface().(byte)
-		}
-		mp := string(byteArray)
-		mp = mp[0 : len(mp)-1]
+	props := InterfacesAndProperties{dbusFilesystemInterface: VariantMap{mountPointsProperty: mountpointsVar}}
+	fs, err := props.FilesystemInfo()
+	if err != nil {
+		log.Println("Error reading mount points:", err)
+		return mountpoints
+	}
+	for _, mp := range fs.MountPoints {
 		log.Println("New mp found", mp)
-		mountpoints[i] = mp
 	}
-	return mountpoints
+	return fs.MountPoints
 }
 
+// ExternalDrives returns a snapshot of the drives that hold no system block devices, the
+// returned drives are not updated when UDisks2 reports changes.
 func (u *UDisks2) ExternalDrives() []Drive {
 	u.startLock.Lock()
 	defer u.startLock.Unlock()
+	u.mapLock.Lock()
+	defer u.mapLock.Unlock()
 	var drives []Drive
 	for _, d := range u.drives {
 		if !d.hasSystemBlockDevices() && len(d.blockDevices) != 0 {
-			drives = append(drives, *d)
+			drives = append(drives, d.snapshot())
 		}
 	}
 	return drives
 }
 
+// BlockDrive returns a snapshot of the drive that holds the block device.
+func (u *UDisks2) BlockDrive(p dbus.ObjectPath) (Drive, bool) {
+	u.mapLock.Lock()
+	defer u.mapLock.Unlock()
+	for _, d := range u.drives {
+		if _, ok := d.blockDevices[p]; ok {
+			return d.snapshot(), true
+		}
+	}
+	return Drive{}, false
+}
+
 func (u *UDisks2) Init() (err error) {
 	d, err := newDispatcher(u.conn)
 	if err == nil {
 		u.dispatcher = d
 		u.jobs = newJobManager(d)
+		u.wg.Add(1)
 		go func() {
+			defer u.wg.Done()
 			for {
 				select {
+				case <-u.done:
+					log.Print("Storage watcher routine done")
+					return
 				case e := <-u.dispatcher.Additions:
 					if err := u.processAddEvent(&e); err != nil {
 						log.Print("Issues while processing ", e.Path, ": ", err)
@@ -319,6 +848,8 @@ func (u *UDisks2) Init() (err error) {
 					if err := u.processRemoveEvent(e.Path, e.Interfaces); err != nil {
 						log.Println("Issues while processing remove event:", err)
 					}
+				case e := <-u.dispatcher.Changes:
+					u.processChangeEvent(&e)
 				case j := <-u.jobs.FormatEraseJobs:
 					if j.WasCompleted {
 						log.Print("Erase job completed.")
@@ -337,13 +868,15 @@ func (u *UDisks2) Init() (err error) {
 					if j.WasCompleted {
 						log.Println("Unmount job was finished for", j.Event.Path, "for paths", j.Paths)
 						for _, path := range j.Paths {
-							u.umountCompleted <- path
+							u.bus.publish(topicUnmountCompleted, path)
 							log.Println("Removing", path, "from", u.mountpoints)
 							delete(u.mountpoints, dbus.ObjectPath(path))
 						}
 					} else {
 						log.Print("Unmount job started.")
 					}
+				case p := <-u.jobs.ProgressJobs:
+					u.bus.publish(topicJobProgress, p)
 				case j := <-u.jobs.MountJobs:
 					if j.WasCompleted {
 						log.Println("Mount job was finished for", j.Event.Path, "for paths", j.Paths)
@@ -366,13 +899,17 @@ func (u *UDisks2) Init() (err error) {
 												_, err := os.Stat(mp)
 												if err != nil {
 													log.Println("Mountpoint", mp, "not yet present. Wating", t, "seconds due to", err)
-													time.Sleep(time.Duration(t) * time.Second)
+													select {
+													case <-time.After(time.Duration(t) * time.Second):
+													case <-u.done:
+														return
+													}
 												} else {
 													break
 												}
 											}
 											log.Println("Sending new event to channel.")
-											u.mountCompleted <- e
+											u.bus.publish(topicMountCompleted, e)
 										}()
 									}
 								}
@@ -392,22 +929,24 @@ func (u *UDisks2) Init() (err error) {
 	return err
 }
 
-func (u *UDisks2) connectToSignal(path dbus.ObjectPath, inter, member string) (*dbus.SignalWatch, error) {
-	w, err := u.conn.WatchSignal(&dbus.MatchRule{
-		Type:      dbus.TypeSignal,
-		Sender:    dbusName,
-		Interface: dbusObjectManagerInterface,
-		Member:    member,
-		Path:      path})
-	return w, err
-}
-
-func (u *UDisks2) connectToSignalInterfacesAdded() (*dbus.SignalWatch, error) {
-	return u.connectToSignal(dbusObject, dbusObjectManagerInterface, dbusAddedSignal)
-}
-
-func (u *UDisks2) connectToSignalInterfacesRemoved() (*dbus.SignalWatch, error) {
-	return u.connectToSignal(dbusObject, dbusObjectManagerInterface, dbusRemovedSignal)
+// Close stops watching UDisks2, waits for the goroutines started by Init to be done and
+// closes the channels returned by the Subscribe methods. A closed storage watcher cannot
+// be initialized again, a new one has to be created instead.
+func (u *UDisks2) Close() {
+	u.closeOnce.Do(func() {
+		log.Print("Closing the storage watcher")
+		close(u.done)
+		// closing the subscribers first interrupts any delivery that is blocking the
+		// goroutines that have to be waited for
+		u.bus.close()
+		u.wg.Wait()
+		if u.jobs != nil {
+			u.jobs.Close()
+		}
+		if u.dispatcher != nil {
+			u.dispatcher.Close()
+		}
+	})
 }
 
 func (u *UDisks2) emitExistingDevices() {
@@ -415,7 +954,7 @@ func (u *UDisks2) emitExistingDevices() {
 	u.startLock.Lock()
 	defer u.startLock.Unlock()
 	obj := u.conn.Object(dbusName, dbusObject)
-	reply, err := obj.Call(dbusObjectManagerInterface, "GetManagedObjects")
+	reply, err := call(obj, dbusObjectManagerInterface, "GetManagedObjects")
 	if err != nil {
 		log.Println("Cannot get initial state for devices:", err)
 	}
@@ -426,7 +965,7 @@ func (u *UDisks2) emitExistingDevices() {
 		log.Println("Cannot get initial state for devices:", err)
 	}
 
-	var blocks, drives []*Event
+	var blocks, loops, drives []*Event
 	// separate drives from blocks to avoid aliasing
 	for objectPath, props := range allDevices {
 		s := &Event{objectPath, props, make([]string, 0, 0)}
@@ -434,7 +973,12 @@ func (u *UDisks2) emitExistingDevices() {
 		case deviceTypeDrive:
 			drives = append(drives, s)
 		case deviceTypeBlock:
-			blocks = append(blocks, s)
+			// loop devices act as the drive of their partitions
+			if props.isLoop() {
+				loops = append(loops, s)
+			} else {
+				blocks = append(blocks, s)
+			}
 		}
 	}
 
@@ -444,6 +988,12 @@ func (u *UDisks2) emitExistingDevices() {
 		}
 	}
 
+	for i := range loops {
+		if err := u.processAddEvent(loops[i]); err != nil {
+			log.Println("Error while processing events:", err)
+		}
+	}
+
 	for i := range blocks {
 		if err := u.processAddEvent(blocks[i]); err != nil {
 			log.Println("Error while processing events:", err)
@@ -454,32 +1004,51 @@ func (u *UDisks2) emitExistingDevices() {
 func (u *UDisks2) processAddEvent(s *Event) error {
 	log.Println("processAddEvents(", s.Path, s.Props, s.Interfaces, ")")
 	u.mapLock.Lock()
-	defer u.mapLock.Unlock()
+	events, err := u.addEvents(s)
+	u.mapLock.Unlock()
+
+	// subscribers can call back into UDisks2 so the events are published without the lock
+	for _, e := range events {
+		u.bus.publish(e.topic, e.value)
+	}
+	return err
+}
 
+// addEvents adds the interfaces of the event to the drives and returns the events to be
+// published, mapLock has to be held.
+func (u *UDisks2) addEvents(s *Event) ([]publication, error) {
+	var events []publication
 	pos := sort.SearchStrings(u.pendingMounts, string(s.Path))
 	if pos != len(u.pendingMounts) && s.Props.isFilesystem() {
 		log.Println("Path", s.Path, "must be remounted.")
-		u.formatCompleted <- s
+		events = append(events, publication{topicFormatCompleted, s})
 	}
 
 	if isBlockDevice, err := u.drives.addInterface(s); err != nil {
-		return err
+		return events, err
 	} else if isBlockDevice {
 		log.Println("New block device added.")
-		if u.blockAdded != nil && u.blockError != nil {
-			if ok, err := u.desiredMountableEvent(s); err != nil {
-				u.blockError <- err
-			} else if ok {
-				u.blockAdded <- s
+		if ok, err := u.desiredMountableEvent(s); err != nil {
+			events = append(events, publication{topicBlockError, err})
+		} else if ok {
+			switch action := u.automountAction(s.Path, s.Props); action {
+			case AutomountMount, AutomountReadOnly:
+				events = append(events, publication{topicBlockAdded, s})
+			case AutomountNotify:
+				log.Println("Automount rules block", s.Path)
+				events = append(events, publication{topicBlockBlocked, s})
+			default:
+				log.Println("Automount rules ignore", s.Path)
 			}
+		} else if u.desiredUnlockEvent(s) {
+			log.Println("Encrypted block device", s.Path, "must be unlocked")
+			events = append(events, publication{topicUnlockRequired, s})
 		}
-		if u.blockDevice != nil {
-			log.Println("Sedding block device to channel")
-			u.blockDevice <- true
-		}
+		log.Println("Sedding block device to channel")
+		events = append(events, publication{topicBlockDevice, true})
 	}
 
-	return nil
+	return events, nil
 }
 
 func (u *UDisks2) processRemoveEvent(objectPath dbus.ObjectPath, interfaces Interfaces) error {
@@ -488,8 +1057,8 @@ func (u *UDisks2) processRemoveEvent(objectPath dbus.ObjectPath, interfaces Inte
 	if mounted {
 		log.Println("Removing mountpoint", mountpoint)
 		delete(u.mountpoints, objectPath)
-		if u.mountRemoved != nil && interfaces.desiredUnmountEvent() {
-			u.mountRemoved <- mountpoint
+		if interfaces.desiredUnmountEvent() {
+			u.bus.publish(topicMountRemoved, mountpoint)
 		} else {
 			return errors.New("mounted but does not remove filesystem interface")
 		}
@@ -499,20 +1068,22 @@ func (u *UDisks2) processRemoveEvent(objectPath dbus.ObjectPath, interfaces Inte
 	if strings.HasPrefix(string(objectPath), path.Join(dbusObject, "drives")) {
 		delete(u.drives, objectPath)
 	} else {
-		// TODO: remove filesystem interface from map
+		u.drives.removeInterfaces(objectPath, interfaces)
 	}
 	u.mapLock.Unlock()
-	if u.blockDevice != nil {
-		log.Println("Removing block device to channel.")
-		u.blockDevice <- false
-	}
+	log.Println("Removing block device to channel.")
+	u.bus.publish(topicBlockDevice, false)
 	return nil
 }
 
-func cleanDriveWatch(u *UDisks2) {
-	log.Print("Cancelling Interfaces signal watch")
-	u.driveAdded.Cancel()
-	u.driveRemoved.Cancel()
+func (u *UDisks2) processChangeEvent(s *Event) {
+	u.mapLock.Lock()
+	events := u.drives.mergeChanges(s)
+	u.mapLock.Unlock()
+
+	for _, e := range events {
+		u.bus.publish(topicDriveChanged, e)
+	}
 }
 
 func (iface Interfaces) desiredUnmountEvent() bool {
@@ -525,62 +1096,65 @@ func (iface Interfaces) desiredUnmountEvent() bool {
 	return false
 }
 
-func (u *UDisks2) desiredMountableEvent(s *Event) (bool, error) {
-	// No file system interface means we can't mount it even if we wanted to
-	_, ok := s.Props[dbusFilesystemInterface]
-	if !ok {
-		log.Println("Filesystem interface is missing.")
-		return false, nil
+// desiredUnlockEvent returns if the event is for a locked encrypted block device of a
+// removable drive.
+func (u *UDisks2) desiredUnlockEvent(s *Event) bool {
+	if !s.Props.isLocked() {
+		return false
 	}
+	return u.removableDriveEvent(s)
+}
 
-	drivePath, err := s.getDrive()
+// removableDriveEvent returns if the block device of the event belongs to a known drive
+// with removable media that holds no system block devices.
+func (u *UDisks2) removableDriveEvent(s *Event) bool {
+	drivePath, err := u.drives.drivePath(s)
 	if err != nil {
 		log.Println("Issues while getting drive:", err)
-		return false, nil
+		return false
 	}
 
 	drive, ok := u.drives[drivePath]
 	if !ok {
 		log.Println("Drive with path", drivePath, "not found")
-		return false, nil
+		return false
 	}
 
 	if ok := drive.hasSystemBlockDevices(); ok {
 		log.Println(drivePath, "which contains", s.Path, "has HintSystem set")
-		return false, nil
+		return false
 	}
 
-	driveProps, ok := drive.driveInfo[dbusDriveInterface]
+	if !drive.Info().MediaRemovable && !drive.isLoop() {
+		log.Println(drivePath, "which holds", s.Path, "is not MediaRemovable")
+		return false
+	}
+	return true
+}
+
+func (u *UDisks2) desiredMountableEvent(s *Event) (bool, error) {
+	// No file system interface means we can't mount it even if we wanted to
+	_, ok := s.Props[dbusFilesystemInterface]
 	if !ok {
-		log.Println(drivePath, "doesn't hold a Drive interface")
+		log.Println("Filesystem interface is missing.")
 		return false, nil
 	}
-	if mediaRemovableVariant, ok := driveProps["MediaRemovable"]; !ok {
-		log.Println(drivePath, "which holds", s.Path, "doesn't have MediaRemovable")
+
+	if !u.removableDriveEvent(s) {
 		return false, nil
-	} else {
-		mediaRemovable := reflect.ValueOf(mediaRemovableVariant.Value).Bool()
-		if !mediaRemovable {
-			log.Println(drivePath, "which holds", s.Path, "is not MediaRemovable")
-			return false, nil
-		}
 	}
 
 	if s.Props.isMounted() {
 		return false, nil
 	}
 
-	propBlock, ok := s.Props[dbusBlockInterface]
-	if !ok {
-		return false, nil
-	}
-	id, ok := propBlock["IdType"]
-	if !ok {
-		log.Println(s.Path, "doesn't hold IdType")
+	block, err := s.Props.BlockInfo()
+	if err != nil {
+		log.Println(s.Path, "holds invalid block properties:", err)
 		return false, nil
 	}
 
-	fs := reflect.ValueOf(id.Value).String()
+	fs := block.IdType
 	if fs == "" {
 		return false, nil
 	}
@@ -596,25 +1170,131 @@ func (u *UDisks2) desiredMountableEvent(s *Event) (bool, error) {
 
 func (d *Drive) hasSystemBlockDevices() bool {
 	for _, blockDevice := range d.blockDevices {
-		if propBlock, ok := blockDevice[dbusBlockInterface]; ok {
-			if systemHintVariant, ok := propBlock["HintSystem"]; ok {
-				return reflect.ValueOf(systemHintVariant.Value).Bool()
-			}
+		if blockDevice.hintSystem() {
+			return true
 		}
 	}
 	return false
 }
 
+// Model returns the model of the drive, or the name of the backing file of loop devices.
 func (d *Drive) Model() string {
-	propDrive, ok := d.driveInfo[dbusDriveInterface]
-	if !ok {
-		return ""
+	if loop, err := d.driveInfo.LoopInfo(); err == nil && loop.BackingFile != "" {
+		return path.Base(loop.BackingFile)
 	}
-	modelVariant, ok := propDrive["Model"]
-	if !ok {
-		return ""
+	return d.Info().Model
+}
+
+func (d *Drive) isLoop() bool {
+	return d.driveInfo.isLoop()
+}
+
+// Vendor returns the name of the vendor of the drive.
+func (d *Drive) Vendor() string {
+	return d.Info().Vendor
+}
+
+// Serial returns the serial number of the drive.
+func (d *Drive) Serial() string {
+	return d.Info().Serial
+}
+
+// Size returns the size of the drive in bytes, 0 when there is no media.
+func (d *Drive) Size() uint64 {
+	return d.Info().Size
+}
+
+// ConnectionBus returns the bus the drive is connected to, for example usb or sdio.
+func (d *Drive) ConnectionBus() string {
+	return d.Info().ConnectionBus
+}
+
+// Removable returns if the drive or its media can be removed.
+func (d *Drive) Removable() bool {
+	info := d.Info()
+	return info.Removable || info.MediaRemovable
+}
+
+// Ejectable returns if the media of the drive can be ejected by software.
+func (d *Drive) Ejectable() bool {
+	return d.Info().Ejectable
+}
+
+// IdLabel returns the label of the first filesystem of the drive that has one.
+func (d *Drive) IdLabel() string {
+	for _, p := range d.blockPaths() {
+		block, err := d.blockDevices[p].BlockInfo()
+		if err == nil && block.IdUsage == "filesystem" && block.IdLabel != "" {
+			return block.IdLabel
+		}
+	}
+	return ""
+}
+
+// Info returns the properties of the drive.
+func (d *Drive) Info() DriveInfo {
+	if d.info == nil {
+		return DriveInfo{}
+	}
+	return *d.info
+}
+
+// BlockDevices returns the block devices of the drive sorted by path. Block devices
+// whose properties cannot be decoded are left out.
+func (d *Drive) BlockDevices() []BlockDevice {
+	var blocks []BlockDevice
+	for _, p := range d.blockPaths() {
+		block, err := newBlockDevice(p, d.blockDevices[p])
+		if err != nil {
+			log.Println("Ignoring block device", p, ":", err)
+			continue
+		}
+		blocks = append(blocks, *block)
+	}
+	return blocks
+}
+
+// blockPaths returns the paths of the block devices of the drive sorted so that the
+// callers picking the first match always pick the same block device.
+func (d *Drive) blockPaths() []dbus.ObjectPath {
+	paths := make([]string, 0, len(d.blockDevices))
+	for p, _ := range d.blockDevices {
+		paths = append(paths, string(p))
 	}
-	return reflect.ValueOf(modelVariant.Value).String()
+	sort.Strings(paths)
+	blockPaths := make([]dbus.ObjectPath, len(paths))
+	for i, p := range paths {
+		blockPaths[i] = dbus.ObjectPath(p)
+	}
+	return blockPaths
+}
+
+// snapshot returns a copy of the drive that does not share the cached properties with it.
+func (d *Drive) snapshot() Drive {
+	c := *d
+	c.blockDevices = make(map[dbus.ObjectPath]InterfacesAndProperties, len(d.blockDevices))
+	for p, props := range d.blockDevices {
+		c.blockDevices[p] = props.copy()
+	}
+	c.driveInfo = d.driveInfo.copy()
+	return c
+}
+
+// refresh updates the state derived from the cached properties of the drive.
+func (d *Drive) refresh() {
+	info, err := d.driveInfo.DriveInfo()
+	if err != nil {
+		log.Println("Issues while reading the drive properties of", d.Path, ":", err)
+		info = &DriveInfo{}
+	}
+	d.info = info
+	mounted := false
+	for _, blockDevice := range d.blockDevices {
+		if blockDevice.isMounted() {
+			mounted = true
+		}
+	}
+	d.Mounted = mounted
 }
 
 func (d *Drive) SetMounted(path dbus.ObjectPath) bool {
@@ -628,22 +1308,107 @@ func (d *Drive) SetMounted(path dbus.ObjectPath) bool {
 }
 
 func (s *Event) getDrive() (dbus.ObjectPath, error) {
-	propBlock, ok := s.Props[dbusBlockInterface]
-	if !ok {
-		return "", fmt.Errorf("interface %s not found", dbusBlockInterface)
+	block, err := s.Props.BlockInfo()
+	if err != nil {
+		return "", err
 	}
-	driveVariant, ok := propBlock["Drive"]
-	if !ok {
+	if block.Drive == "" {
 		return "", errors.New("property 'Drive' not found")
 	}
-	return dbus.ObjectPath(reflect.ValueOf(driveVariant.Value).String()), nil
+	return block.Drive, nil
+}
+
+// drivePath returns the path of the drive holding the block device of the event. Cleartext
+// devices of unlocked encrypted blocks have no drive, the drive of the encrypted block is
+// used instead. Loop devices have no drive either, they are used as their own drive.
+func (dm driveMap) drivePath(s *Event) (dbus.ObjectPath, error) {
+	block, err := s.Props.BlockInfo()
+	if err != nil {
+		return "", err
+	}
+	if block.CryptoBackingDevice != "" && block.CryptoBackingDevice != "/" {
+		for p, d := range dm {
+			if _, ok := d.blockDevices[block.CryptoBackingDevice]; ok {
+				return p, nil
+			}
+		}
+	}
+	if block.Drive == "" || block.Drive == "/" {
+		if partition, err := s.Props.PartitionInfo(); err == nil {
+			if d, ok := dm[partition.Table]; ok && d.isLoop() {
+				return partition.Table, nil
+			}
+		}
+		if s.Props.isLoop() {
+			return s.Path, nil
+		}
+	}
+	return s.getDrive()
+}
+
+// Label returns the label of the filesystem of the block device.
+func (b *BlockDevice) Label() string {
+	return b.Block.IdLabel
+}
+
+// UUID returns the UUID of the filesystem of the block device.
+func (b *BlockDevice) UUID() string {
+	return b.Block.IdUUID
+}
+
+// Type returns the filesystem type of the block device, for example vfat.
+func (b *BlockDevice) Type() string {
+	return b.Block.IdType
+}
+
+// Version returns the version of the filesystem of the block device, for example FAT32.
+func (b *BlockDevice) Version() string {
+	return b.Block.IdVersion
+}
+
+// Mountpoints returns the paths where the filesystem of the block device is mounted.
+func (b *BlockDevice) Mountpoints() []string {
+	if b.Filesystem == nil {
+		return nil
+	}
+	return b.Filesystem.MountPoints
+}
+
+func newBlockDevice(p dbus.ObjectPath, props InterfacesAndProperties) (*BlockDevice, error) {
+	block, err := props.BlockInfo()
+	if err != nil {
+		return nil, err
+	}
+	b := &BlockDevice{Path: p, Block: *block}
+	if props.isFilesystem() {
+		if b.Filesystem, err = props.FilesystemInfo(); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := props[dbusPartitionInterface]; ok {
+		if b.Partition, err = props.PartitionInfo(); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := props[dbusEncryptedInterface]; ok {
+		if b.Encrypted, err = props.EncryptedInfo(); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
 }
 
 func newDrive(s *Event) *Drive {
+	info, err := s.Props.DriveInfo()
+	if err != nil {
+		log.Println("Issues while reading the drive properties of", s.Path, ":", err)
+		info = &DriveInfo{}
+	}
 	return &Drive{
 		Path:         s.Path,
 		blockDevices: make(map[dbus.ObjectPath]InterfacesAndProperties),
 		driveInfo:    s.Props,
+		info:         info,
 		Mounted:      s.Props.isMounted(),
 	}
 }
@@ -651,6 +1416,7 @@ func newDrive(s *Event) *Drive {
 const (
 	deviceTypeBlock = iota
 	deviceTypeDrive
+	deviceTypeJob
 	deviceTypeUnhandled
 )
 
@@ -662,6 +1428,8 @@ func objectPathType(objectPath dbus.ObjectPath) dbusObjectPathType {
 		return deviceTypeDrive
 	} else if strings.HasPrefix(objectPathString, path.Join(dbusObject, "block_devices")) {
 		return deviceTypeBlock
+	} else if strings.HasPrefix(objectPathString, jobPrefixPath) {
+		return deviceTypeJob
 	} else {
 		return deviceTypeUnhandled
 	}
@@ -677,13 +1445,18 @@ func (dm *driveMap) addInterface(s *Event) (bool, error) {
 		}
 		(*dm)[s.Path] = newDrive(s)
 	case deviceTypeBlock:
-		driveObjectPath, err := s.getDrive()
+		driveObjectPath, err := dm.drivePath(s)
 		if err != nil {
 			return blockDevice, err
 		}
 		if _, ok := (*dm)[driveObjectPath]; !ok {
 			drive := newDrive(s)
 			log.Println("Creating new drive", drive)
+			if s.Props.isLoop() {
+				// a loop device is its own drive
+				drive.blockDevices[s.Path] = s.Props
+				drive.refresh()
+			}
 			(*dm)[s.Path] = drive
 		} else {
 			(*dm)[driveObjectPath].blockDevices[s.Path] = s.Props
@@ -697,3 +1470,69 @@ func (dm *driveMap) addInterface(s *Event) (bool, error) {
 
 	return blockDevice, nil
 }
+
+// removeInterfaces drops the interfaces from the cached properties of the block device,
+// the block device itself is dropped when it loses the block interface, which is what
+// happens to the cleartext device of an encrypted block when it is locked.
+func (dm driveMap) removeInterfaces(objectPath dbus.ObjectPath, interfaces Interfaces) {
+	for _, d := range dm {
+		props, ok := d.blockDevices[objectPath]
+		if !ok {
+			continue
+		}
+		for _, inter := range interfaces {
+			if inter == dbusBlockInterface {
+				delete(d.blockDevices, objectPath)
+				break
+			}
+			delete(props, inter)
+		}
+		d.refresh()
+		if d.Path == objectPath && len(d.blockDevices) == 0 {
+			// loop devices are their own drive
+			delete(dm, objectPath)
+		}
+	}
+}
+
+// mergeChanges merges the properties carried by a PropertiesChanged event into the cached
+// properties of the drive or block device it belongs to and returns the events to be
+// emitted, one per changed interface.
+func (dm driveMap) mergeChanges(s *Event) []ChangeEvent {
+	var drive *Drive
+	var props InterfacesAndProperties
+	switch objectPathType(s.Path) {
+	case deviceTypeDrive:
+		if d, ok := dm[s.Path]; ok {
+			drive, props = d, d.driveInfo
+		}
+	case deviceTypeBlock:
+		for _, d := range dm {
+			if p, ok := d.blockDevices[s.Path]; ok {
+				drive, props = d, p
+				break
+			}
+		}
+	}
+	if drive == nil {
+		log.Println("Ignoring property changes for unknown path", s.Path)
+		return nil
+	}
+
+	var events []ChangeEvent
+	for inter, changed := range s.Props {
+		if props[inter] == nil {
+			props[inter] = make(VariantMap)
+		}
+		names := make([]string, 0, len(changed))
+		for name, value := range changed {
+			props[inter][name] = value
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		log.Println("Properties", names, "of", inter, "changed for", s.Path)
+		events = append(events, ChangeEvent{drive.Path, s.Path, inter, names})
+	}
+	drive.refresh()
+	return events
+}
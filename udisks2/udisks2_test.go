@@ -0,0 +1,319 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"launchpad.net/go-dbus/v1"
+	. "launchpad.net/gocheck"
+)
+
+const (
+	testDrivePath = dbus.ObjectPath("/org/freedesktop/UDisks2/drives/SD")
+	testBlockPath = dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/mmcblk1p1")
+)
+
+type DriveMapTestSuite struct {
+	drives driveMap
+}
+
+var _ = Suite(&DriveMapTestSuite{})
+
+func (s *DriveMapTestSuite) SetUpTest(c *C) {
+	driveProps := make(InterfacesAndProperties)
+	driveProps[dbusDriveInterface] = make(map[string]dbus.Variant)
+	driveProps[dbusDriveInterface]["Model"] = dbus.Variant{"SD"}
+	driveProps[dbusDriveInterface]["MediaRemovable"] = dbus.Variant{true}
+
+	blockProps := make(InterfacesAndProperties)
+	blockProps[dbusBlockInterface] = make(map[string]dbus.Variant)
+	blockProps[dbusBlockInterface]["Drive"] = dbus.Variant{testDrivePath}
+	blockProps[dbusBlockInterface]["IdType"] = dbus.Variant{"vfat"}
+	blockProps[dbusFilesystemInterface] = make(map[string]dbus.Variant)
+	blockProps[dbusFilesystemInterface]["MountPoints"] = dbus.Variant{[]string{}}
+
+	s.drives = make(driveMap)
+	_, err := s.drives.addInterface(&Event{testDrivePath, driveProps, nil})
+	c.Assert(err, IsNil)
+	_, err = s.drives.addInterface(&Event{testBlockPath, blockProps, nil})
+	c.Assert(err, IsNil)
+}
+
+func (s *DriveMapTestSuite) TestMergeChangesUnknownPath(c *C) {
+	props := make(InterfacesAndProperties)
+	props[dbusBlockInterface] = make(map[string]dbus.Variant)
+	props[dbusBlockInterface]["IdLabel"] = dbus.Variant{"CAMERA"}
+
+	events := s.drives.mergeChanges(&Event{"/org/freedesktop/UDisks2/block_devices/sda", props, nil})
+	c.Assert(len(events), Equals, 0)
+}
+
+func (s *DriveMapTestSuite) TestMergeChangesBlockMounted(c *C) {
+	c.Assert(s.drives[testDrivePath].Mounted, Equals, false)
+
+	props := make(InterfacesAndProperties)
+	props[dbusFilesystemInterface] = make(map[string]dbus.Variant)
+	props[dbusFilesystemInterface]["MountPoints"] = dbus.Variant{[]string{"/media/phablet/CAMERA"}}
+
+	events := s.drives.mergeChanges(&Event{testBlockPath, props, nil})
+	c.Assert(events, DeepEquals, []ChangeEvent{
+		{testDrivePath, testBlockPath, dbusFilesystemInterface, []string{"MountPoints"}},
+	})
+	c.Assert(s.drives[testDrivePath].Mounted, Equals, true)
+	// the rest of the cached properties are kept
+	block, err := s.drives[testDrivePath].blockDevices[testBlockPath].BlockInfo()
+	c.Assert(err, IsNil)
+	c.Assert(block.IdType, Equals, "vfat")
+}
+
+func (s *DriveMapTestSuite) TestMergeChangesDrive(c *C) {
+	props := make(InterfacesAndProperties)
+	props[dbusDriveInterface] = make(map[string]dbus.Variant)
+	props[dbusDriveInterface]["Model"] = dbus.Variant{"Camera Card"}
+
+	events := s.drives.mergeChanges(&Event{testDrivePath, props, nil})
+	c.Assert(len(events), Equals, 1)
+	c.Assert(s.drives[testDrivePath].Model(), Equals, "Camera Card")
+	c.Assert(s.drives[testDrivePath].Info().MediaRemovable, Equals, true)
+}
+
+func (s *DriveMapTestSuite) addCleartextDevice(c *C) dbus.ObjectPath {
+	cleartextPath := dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/dm_2d0")
+	props := make(InterfacesAndProperties)
+	props[dbusBlockInterface] = make(map[string]dbus.Variant)
+	props[dbusBlockInterface]["Drive"] = dbus.Variant{dbus.ObjectPath("/")}
+	props[dbusBlockInterface]["CryptoBackingDevice"] = dbus.Variant{testBlockPath}
+	props[dbusFilesystemInterface] = make(map[string]dbus.Variant)
+	props[dbusFilesystemInterface]["MountPoints"] = dbus.Variant{[]string{"/media/phablet/SECRET"}}
+
+	isBlock, err := s.drives.addInterface(&Event{cleartextPath, props, nil})
+	c.Assert(err, IsNil)
+	c.Assert(isBlock, Equals, true)
+	return cleartextPath
+}
+
+func (s *DriveMapTestSuite) TestAddInterfaceCleartextDevice(c *C) {
+	cleartextPath := s.addCleartextDevice(c)
+	_, ok := s.drives[testDrivePath].blockDevices[cleartextPath]
+	c.Assert(ok, Equals, true)
+	c.Assert(s.drives[testDrivePath].Mounted, Equals, true)
+}
+
+func (s *DriveMapTestSuite) TestRemoveInterfacesBlock(c *C) {
+	cleartextPath := s.addCleartextDevice(c)
+	s.drives.removeInterfaces(cleartextPath, Interfaces{dbusBlockInterface, dbusFilesystemInterface})
+	_, ok := s.drives[testDrivePath].blockDevices[cleartextPath]
+	c.Assert(ok, Equals, false)
+	c.Assert(s.drives[testDrivePath].Mounted, Equals, false)
+}
+
+func (s *DriveMapTestSuite) TestRemoveInterfacesFilesystem(c *C) {
+	s.drives.removeInterfaces(testBlockPath, Interfaces{dbusFilesystemInterface})
+	props, ok := s.drives[testDrivePath].blockDevices[testBlockPath]
+	c.Assert(ok, Equals, true)
+	c.Assert(props.isFilesystem(), Equals, false)
+}
+
+func (s *DriveMapTestSuite) TestIdLabel(c *C) {
+	c.Assert(s.drives[testDrivePath].IdLabel(), Equals, "")
+
+	props := s.drives[testDrivePath].blockDevices[testBlockPath]
+	props[dbusBlockInterface]["IdUsage"] = dbus.Variant{"filesystem"}
+	props[dbusBlockInterface]["IdLabel"] = dbus.Variant{"SHIFT A"}
+	c.Assert(s.drives[testDrivePath].IdLabel(), Equals, "SHIFT A")
+}
+
+func (s *DriveMapTestSuite) TestSnapshot(c *C) {
+	drive := s.drives[testDrivePath]
+	snapshot := drive.snapshot()
+
+	props := make(InterfacesAndProperties)
+	props[dbusBlockInterface] = make(map[string]dbus.Variant)
+	props[dbusBlockInterface]["IdLabel"] = dbus.Variant{"SHIFT B"}
+	s.drives.mergeChanges(&Event{testBlockPath, props, nil})
+	s.drives.removeInterfaces(testBlockPath, Interfaces{dbusFilesystemInterface})
+
+	blocks := snapshot.BlockDevices()
+	c.Assert(len(blocks), Equals, 1)
+	c.Assert(blocks[0].Label(), Equals, "")
+	c.Assert(blocks[0].Type(), Equals, "vfat")
+	c.Assert(blocks[0].Filesystem, NotNil)
+	c.Assert(snapshot.Model(), Equals, "SD")
+	c.Assert(snapshot.Removable(), Equals, true)
+}
+
+func (s *DriveMapTestSuite) TestAddInterfaceLoopDevice(c *C) {
+	loopPath := dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/loop0")
+	loopProps := make(InterfacesAndProperties)
+	loopProps[dbusBlockInterface] = make(map[string]dbus.Variant)
+	loopProps[dbusBlockInterface]["Drive"] = dbus.Variant{dbus.ObjectPath("/")}
+	loopProps[dbusLoopInterface] = make(map[string]dbus.Variant)
+	loopProps[dbusLoopInterface]["BackingFile"] = dbus.Variant{[]byte("/home/phablet/camera.img\x00")}
+	_, err := s.drives.addInterface(&Event{loopPath, loopProps, nil})
+	c.Assert(err, IsNil)
+
+	partitionPath := dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/loop0p1")
+	partitionProps := make(InterfacesAndProperties)
+	partitionProps[dbusBlockInterface] = make(map[string]dbus.Variant)
+	partitionProps[dbusBlockInterface]["Drive"] = dbus.Variant{dbus.ObjectPath("/")}
+	partitionProps[dbusPartitionInterface] = make(map[string]dbus.Variant)
+	partitionProps[dbusPartitionInterface]["Table"] = dbus.Variant{loopPath}
+	_, err = s.drives.addInterface(&Event{partitionPath, partitionProps, nil})
+	c.Assert(err, IsNil)
+
+	drive, ok := s.drives[loopPath]
+	c.Assert(ok, Equals, true)
+	c.Assert(drive.Model(), Equals, "camera.img")
+	c.Assert(len(drive.blockDevices), Equals, 2)
+
+	s.drives.removeInterfaces(partitionPath, Interfaces{dbusBlockInterface, dbusPartitionInterface})
+	s.drives.removeInterfaces(loopPath, Interfaces{dbusBlockInterface, dbusLoopInterface})
+	_, ok = s.drives[loopPath]
+	c.Assert(ok, Equals, false)
+}
+
+type WaitForTestSuite struct{}
+
+var _ = Suite(&WaitForTestSuite{})
+
+func (s *WaitForTestSuite) TestWaitForResult(c *C) {
+	value, err := waitFor(context.Background(), func() (string, error) {
+		return "/media/phablet/CAMERA", nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "/media/phablet/CAMERA")
+}
+
+func (s *WaitForTestSuite) TestWaitForError(c *C) {
+	expected := errors.New("mount failed")
+	_, err := waitFor(context.Background(), func() (string, error) {
+		return "", expected
+	})
+	c.Assert(err, Equals, expected)
+}
+
+func (s *WaitForTestSuite) TestWaitForContextDone(c *C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	defer close(release)
+
+	_, err := waitFor(ctx, func() (string, error) {
+		<-release
+		return "/media/phablet/CAMERA", nil
+	})
+	c.Assert(err, Equals, context.DeadlineExceeded)
+}
+
+func (s *WaitForTestSuite) TestUnmountSyncNotMounted(c *C) {
+	u := &UDisks2{}
+	err := u.UnmountSync(context.Background(), &Drive{Path: testDrivePath}, DefaultUnmountMode)
+	c.Assert(err, Equals, ErrNotMounted)
+}
+
+func (s *DriveMapTestSuite) TestPowerOffNotSupported(c *C) {
+	u := &UDisks2{}
+	c.Assert(u.PowerOff(s.drives[testDrivePath]), Equals, ErrCannotPowerOff)
+}
+
+func (s *DriveMapTestSuite) TestEjectNotEjectable(c *C) {
+	u := &UDisks2{}
+	c.Assert(s.drives[testDrivePath].Ejectable(), Equals, false)
+	c.Assert(u.Eject(s.drives[testDrivePath]), Equals, ErrNotEjectable)
+}
+
+func (s *DriveMapTestSuite) TestDesiredMountableEventFilesystems(c *C) {
+	u := NewStorageWatcher(nil, FilesystemVfat, FilesystemNtfs, FilesystemExt4, FilesystemExfat)
+	u.drives = s.drives
+	props := s.drives[testDrivePath].blockDevices[testBlockPath]
+	for _, fs := range []string{FilesystemVfat, FilesystemExfat, FilesystemExt4, FilesystemNtfs} {
+		props[dbusBlockInterface]["IdType"] = dbus.Variant{fs}
+		mountable, err := u.desiredMountableEvent(&Event{testBlockPath, props, nil})
+		c.Assert(err, IsNil)
+		c.Assert(mountable, Equals, true, Commentf("filesystem %s", fs))
+	}
+
+	props[dbusBlockInterface]["IdType"] = dbus.Variant{"btrfs"}
+	_, err := u.desiredMountableEvent(&Event{testBlockPath, props, nil})
+	c.Assert(err, Equals, ErrUnhandledFileSystem)
+}
+
+func (s *DriveMapTestSuite) TestProcessAddEventPublishesWithoutLock(c *C) {
+	u := NewStorageWatcher(nil, FilesystemVfat)
+	u.drives = s.drives
+	added, _ := u.SubscribeAddEvents(SubscribeOptions{Buffer: 0, Policy: Block})
+
+	partitionPath := dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/mmcblk1p2")
+	props := make(InterfacesAndProperties)
+	props[dbusBlockInterface] = map[string]dbus.Variant{
+		"Drive":  dbus.Variant{testDrivePath},
+		"IdType": dbus.Variant{"vfat"},
+	}
+	props[dbusFilesystemInterface] = map[string]dbus.Variant{"MountPoints": dbus.Variant{[]string{}}}
+	go u.processAddEvent(&Event{partitionPath, props, nil})
+
+	// the subscriber looks up the drive before reading the event, as the daemon does
+	known := make(chan bool)
+	go func() {
+		for {
+			if _, ok := u.BlockDrive(partitionPath); ok {
+				known <- true
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-known:
+	case <-time.After(time.Second):
+		c.Fatal("the drives are locked while the add event is published")
+	}
+
+	select {
+	case e := <-added:
+		c.Assert(e.Path, Equals, partitionPath)
+	case <-time.After(time.Second):
+		c.Fatal("no add event")
+	}
+}
+
+func (s *DriveMapTestSuite) TestBlockDevicesSorted(c *C) {
+	for _, name := range []string{"mmcblk1p3", "mmcblk1", "mmcblk1p2"} {
+		props := make(InterfacesAndProperties)
+		props[dbusBlockInterface] = map[string]dbus.Variant{"Drive": dbus.Variant{testDrivePath}}
+		p := dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/" + name)
+		_, err := s.drives.addInterface(&Event{p, props, nil})
+		c.Assert(err, IsNil)
+	}
+
+	var paths []dbus.ObjectPath
+	for _, block := range s.drives[testDrivePath].BlockDevices() {
+		paths = append(paths, block.Path)
+	}
+	c.Assert(paths, DeepEquals, []dbus.ObjectPath{
+		"/org/freedesktop/UDisks2/block_devices/mmcblk1",
+		testBlockPath,
+		"/org/freedesktop/UDisks2/block_devices/mmcblk1p2",
+		"/org/freedesktop/UDisks2/block_devices/mmcblk1p3",
+	})
+}
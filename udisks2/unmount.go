@@ -0,0 +1,85 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	firstUnmountRetry = 250 * time.Millisecond
+	maxUnmountRetry   = 2 * time.Second
+)
+
+// ErrDetached is returned once a busy filesystem is lazily unmounted, it is no longer
+// visible but the processes using it can still write to the device.
+var ErrDetached = errors.New("filesystem detached while still in use")
+
+// sleep waits between unmount attempts, it is changed by the tests.
+var sleep = time.Sleep
+
+// UnmountMode controls what is done when a filesystem is busy.
+type UnmountMode struct {
+	// Retry is for how long a busy filesystem is unmounted again, with backoff.
+	Retry time.Duration
+	// Force does a lazy unmount once the retries failed, the filesystem is detached
+	// right away and cleaned up once it is no longer busy.
+	Force bool
+}
+
+// DefaultUnmountMode gives short lived users, like the media scanner, time to close
+// their files.
+var DefaultUnmountMode = UnmountMode{Retry: 5 * time.Second}
+
+// ForceUnmountMode is DefaultUnmountMode followed by a lazy unmount, it should only be
+// used once the user confirmed it.
+var ForceUnmountMode = UnmountMode{Retry: 5 * time.Second, Force: true}
+
+// retryUnmount calls unmount until the filesystem is no longer busy or the mode gives up,
+// ErrDetached is returned when the mode ends with a lazy unmount.
+func retryUnmount(mode UnmountMode, unmount func(force bool) error) error {
+	wait := firstUnmountRetry
+	var elapsed time.Duration
+	for {
+		err := unmount(false)
+		if err != ErrBusy || elapsed >= mode.Retry {
+			if err != ErrBusy || !mode.Force {
+				return err
+			}
+			break
+		}
+		if remaining := mode.Retry - elapsed; wait > remaining {
+			wait = remaining
+		}
+		log.Println("Filesystem busy, unmounting again in", wait)
+		sleep(wait)
+		elapsed += wait
+		if wait *= 2; wait > maxUnmountRetry {
+			wait = maxUnmountRetry
+		}
+	}
+	log.Println("Filesystem still busy, doing a lazy unmount")
+	if err := unmount(true); err != nil {
+		return err
+	}
+	return ErrDetached
+}
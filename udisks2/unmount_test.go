@@ -0,0 +1,112 @@
+/*
+ * Copyright 2015 Canonical Ltd.
+ *
+ * Authors:
+ * Manuel de la Pena : manuel.delapena@cannical.com
+ *
+ * ciborium is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; version 3.
+ *
+ * ciborium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package udisks2
+
+import (
+	"time"
+
+	. "launchpad.net/gocheck"
+)
+
+type UnmountTestSuite struct {
+	waits []time.Duration
+}
+
+var _ = Suite(&UnmountTestSuite{})
+
+func (s *UnmountTestSuite) SetUpTest(c *C) {
+	s.waits = nil
+	sleep = func(d time.Duration) {
+		s.waits = append(s.waits, d)
+	}
+}
+
+func (s *UnmountTestSuite) TearDownTest(c *C) {
+	sleep = time.Sleep
+}
+
+// busyFor returns an unmount function that is busy for the given number of attempts.
+func busyFor(attempts int, forced *bool) func(bool) error {
+	return func(force bool) error {
+		if force {
+			*forced = true
+			return nil
+		}
+		if attempts > 0 {
+			attempts--
+			return ErrBusy
+		}
+		return nil
+	}
+}
+
+func (s *UnmountTestSuite) TestNoRetry(c *C) {
+	var forced bool
+	err := retryUnmount(UnmountMode{}, busyFor(1, &forced))
+	c.Assert(err, Equals, ErrBusy)
+	c.Assert(forced, Equals, false)
+	c.Assert(s.waits, HasLen, 0)
+}
+
+func (s *UnmountTestSuite) TestRetryUntilNotBusy(c *C) {
+	var forced bool
+	err := retryUnmount(DefaultUnmountMode, busyFor(2, &forced))
+	c.Assert(err, IsNil)
+	c.Assert(forced, Equals, false)
+	c.Assert(s.waits, DeepEquals, []time.Duration{250 * time.Millisecond, 500 * time.Millisecond})
+}
+
+func (s *UnmountTestSuite) TestRetryGivesUp(c *C) {
+	var forced bool
+	err := retryUnmount(DefaultUnmountMode, busyFor(100, &forced))
+	c.Assert(err, Equals, ErrBusy)
+	c.Assert(forced, Equals, false)
+
+	var total time.Duration
+	for _, w := range s.waits {
+		c.Assert(w <= maxUnmountRetry, Equals, true)
+		total += w
+	}
+	c.Assert(total, Equals, DefaultUnmountMode.Retry)
+}
+
+func (s *UnmountTestSuite) TestForceAfterRetries(c *C) {
+	var forced bool
+	err := retryUnmount(ForceUnmountMode, busyFor(100, &forced))
+	c.Assert(err, Equals, ErrDetached)
+	c.Assert(forced, Equals, true)
+}
+
+func (s *UnmountTestSuite) TestForceNotNeeded(c *C) {
+	var forced bool
+	err := retryUnmount(ForceUnmountMode, busyFor(1, &forced))
+	c.Assert(err, IsNil)
+	c.Assert(forced, Equals, false)
+}
+
+func (s *UnmountTestSuite) TestOtherErrorsNotRetried(c *C) {
+	attempts := 0
+	err := retryUnmount(ForceUnmountMode, func(force bool) error {
+		attempts++
+		return ErrNotAuthorized
+	})
+	c.Assert(err, Equals, ErrNotAuthorized)
+	c.Assert(attempts, Equals, 1)
+}